@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// accessLogger writes one structured log line per request.
+type accessLogger struct {
+	logger         *slog.Logger
+	sampleRate     float64
+	trustedProxies []netip.Prefix
+}
+
+func newAccessLogger(cfg AccessLogConfig, w io.Writer) (*accessLogger, error) {
+	var handler slog.Handler
+	switch cfg.Format {
+	case "", "text":
+		handler = slog.NewTextHandler(w, nil)
+	case "json":
+		handler = slog.NewJSONHandler(w, nil)
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", cfg.Format)
+	}
+
+	proxies := make([]netip.Prefix, 0, len(cfg.TrustedProxies))
+	for _, proxy := range cfg.TrustedProxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, prefix)
+	}
+
+	sampleRate := cfg.SampleRate
+	if sampleRate == 0 {
+		sampleRate = 1
+	}
+
+	return &accessLogger{
+		logger:         slog.New(handler),
+		sampleRate:     sampleRate,
+		trustedProxies: proxies,
+	}, nil
+}
+
+// Middleware wraps the given handler, logging requests made to it.
+func (l *accessLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.sampleRate < 1 && rand.Float64() >= l.sampleRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		r, info := withRequestInfo(r)
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		l.logger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("package", info.Package),
+			slog.Int("status", rec.StatusCode()),
+			slog.Int64("bytes", rec.Bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", l.clientAddr(r)),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
+
+// clientAddr returns the address of the client that made the request.
+//
+// If the request came from a trusted proxy, the address is taken from the
+// X-Forwarded-For header, skipping over any other trusted proxies,
+// or from the X-Real-IP header if X-Forwarded-For is absent.
+func (l *accessLogger) clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !l.trusted(host) {
+		return host
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(header, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(addr))
+		}
+	}
+
+	// Each proxy appends the address it received the request from,
+	// so the rightmost untrusted address is the client.
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if !l.trusted(forwarded[i]) {
+			return forwarded[i]
+		}
+		host = forwarded[i]
+	}
+
+	if len(forwarded) == 0 {
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return realIP
+		}
+	}
+	return host
+}
+
+func (l *accessLogger) trusted(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range l.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefix parses an IP address or a CIDR range into a netip.Prefix.
+// A single address is treated as a range containing only that address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
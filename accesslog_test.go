@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newAccessLogger(AccessLogConfig{Format: "json"}, &buf)
+	require.NoError(t, err)
+	handler := l.Middleware(CreateHandlerFromYAML(t, getTestTemplates(t, nil), config))
+
+	req := httptest.NewRequest("GET", "/zap/zapcore?go-get=1", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("User-Agent", "Go-http-client/1.1")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/zap/zapcore", entry["path"])
+	assert.Equal(t, "zap", entry["package"])
+	assert.Equal(t, float64(200), entry["status"])
+	assert.Equal(t, float64(rr.Body.Len()), entry["bytes"])
+	assert.Equal(t, "192.0.2.1", entry["remote_addr"])
+	assert.Equal(t, "Go-http-client/1.1", entry["user_agent"])
+	assert.Contains(t, entry, "duration")
+}
+
+func TestAccessLogPattern(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newAccessLogger(AccessLogConfig{Format: "json"}, &buf)
+	require.NoError(t, err)
+	handler := l.Middleware(CreateHandlerFromYAML(t, getTestTemplates(t, nil), patternConfig))
+
+	serve(handler, "/atomic/internal?go-get=1")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "atomic", entry["package"], "must log the resolved package, not the pattern")
+}
+
+func TestAccessLogText(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newAccessLogger(AccessLogConfig{}, &buf)
+	require.NoError(t, err)
+	handler := l.Middleware(CreateHandlerFromYAML(t, getTestTemplates(t, nil), config))
+
+	serve(handler, "/nonexistent")
+	line := buf.String()
+	assert.Contains(t, line, "msg=request method=GET path=/nonexistent package=\"\" status=404")
+	assert.Equal(t, 1, strings.Count(line, "\n"))
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newAccessLogger(AccessLogConfig{SampleRate: 1e-12}, &buf)
+	require.NoError(t, err)
+	handler := l.Middleware(CreateHandlerFromYAML(t, getTestTemplates(t, nil), config))
+
+	for i := 0; i < 100; i++ {
+		serve(handler, "/zap")
+	}
+	assert.Empty(t, buf.String())
+}
+
+func TestAccessLogClientAddr(t *testing.T) {
+	l, err := newAccessLogger(AccessLogConfig{
+		TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"},
+	}, &bytes.Buffer{})
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{
+			desc:       "direct",
+			remoteAddr: "198.51.100.7:1234",
+			want:       "198.51.100.7",
+		},
+		{
+			desc:       "untrusted peer",
+			remoteAddr: "198.51.100.7:1234",
+			forwarded:  "203.0.113.5",
+			want:       "198.51.100.7",
+		},
+		{
+			desc:       "trusted peer",
+			remoteAddr: "10.1.2.3:1234",
+			forwarded:  "203.0.113.5",
+			want:       "203.0.113.5",
+		},
+		{
+			desc:       "chain of trusted proxies",
+			remoteAddr: "10.1.2.3:1234",
+			forwarded:  "198.51.100.9, 203.0.113.5, 192.0.2.1, 10.4.5.6",
+			want:       "203.0.113.5",
+		},
+		{
+			desc:       "all trusted",
+			remoteAddr: "10.1.2.3:1234",
+			forwarded:  "10.4.5.6",
+			want:       "10.4.5.6",
+		},
+		{
+			desc:       "real ip",
+			remoteAddr: "192.0.2.1:1234",
+			realIP:     "203.0.113.5",
+			want:       "203.0.113.5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			assert.Equal(t, tt.want, l.clientAddr(req))
+		})
+	}
+}
+
+func TestAccessLogConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		config, err := Parse(TempFile(t, `
+url: go.uber.org
+access_log:
+  enabled: true
+`))
+		require.NoError(t, err)
+		assert.Equal(t, AccessLogConfig{
+			Enabled:    true,
+			Format:     "text",
+			SampleRate: 1,
+		}, config.AccessLog)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := Parse(TempFile(t, `
+url: go.uber.org
+access_log:
+  format: xml
+  sample_rate: 2
+  trusted_proxies:
+    - 10.0.0.0/8
+    - not-an-ip
+`))
+		require.Error(t, err)
+		assert.Equal(t, `4:11: access_log.format must be "text" or "json": "xml"
+5:16: access_log.sample_rate must be between 0 and 1: 2
+8:7: access_log.trusted_proxies: ParseAddr("not-an-ip"): unable to parse IP`, err.Error())
+	})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"runtime/debug"
+)
+
+// adminHandler serves sally's operational endpoints
+// in front of the handler for the current configuration.
+//
+//	GET /healthz
+//		Reports that the server is running.
+//	GET /readyz
+//		Reports whether a configuration has been loaded.
+//	GET /version
+//		Reports build information and the loaded configuration.
+//	GET /metrics
+//		Serves Prometheus metrics.
+//
+// These endpoints also answer HEAD and OPTIONS requests,
+// and reject other methods with 405 Method Not Allowed.
+// The paths of these endpoints are configurable with [AdminConfig].
+// Until a configuration has been loaded, the default paths are used.
+type adminHandler struct {
+	reloader *reloader
+	metrics  http.Handler
+	next     http.Handler
+}
+
+var _ http.Handler = (*adminHandler)(nil)
+
+func newAdminHandler(reloader *reloader, metrics, next http.Handler) *adminHandler {
+	return &adminHandler{
+		reloader: reloader,
+		metrics:  metrics,
+		next:     next,
+	}
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	current := h.reloader.Current()
+	paths := _defaultAdminConfig
+	if current != nil {
+		paths = current.Config.Admin
+	}
+
+	var endpoint http.HandlerFunc
+	switch r.URL.Path {
+	case paths.HealthPath:
+		endpoint = func(w http.ResponseWriter, _ *http.Request) {
+			serveText(w, http.StatusOK, "ok")
+		}
+	case paths.ReadyPath:
+		endpoint = func(w http.ResponseWriter, _ *http.Request) {
+			if current == nil {
+				serveText(w, http.StatusServiceUnavailable, errNotLoaded.Error())
+				return
+			}
+			serveText(w, http.StatusOK, "ok")
+		}
+	case paths.VersionPath:
+		endpoint = func(w http.ResponseWriter, _ *http.Request) {
+			serveJSON(w, http.StatusOK, newVersionInfo(h.reloader.path, current))
+		}
+	case paths.MetricsPath:
+		endpoint = h.metrics.ServeHTTP
+	default:
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	// Reject other methods here rather than in next,
+	// which may not check them, as on admin-only listeners.
+	allowReadMethods(endpoint).ServeHTTP(w, r)
+}
+
+// listenerHandler returns the handler for requests on the given listener.
+// Listeners serve packages and the admin endpoints by default,
+// only the admin endpoints if they're admin-only,
+// or only packages if they have no_admin set.
+func listenerHandler(lc ListenerConfig, reloader *reloader, m *metrics) http.Handler {
+	switch {
+	case lc.AdminOnly:
+		return newAdminHandler(reloader, m.Handler(), http.NotFoundHandler())
+	case lc.NoAdmin:
+		return m.Middleware(reloader)
+	default:
+		return newAdminHandler(reloader, m.Handler(), m.Middleware(reloader))
+	}
+}
+
+// versionInfo is the body of the /version endpoint.
+type versionInfo struct {
+	// Version of the sally module, if known.
+	Version string `json:"version,omitempty"`
+
+	// Revision is the version control revision sally was built from.
+	Revision string `json:"revision,omitempty"`
+
+	// Modified reports whether the source tree
+	// had uncommitted changes at build time.
+	Modified bool `json:"modified,omitempty"`
+
+	// GoVersion is the version of Go used to build sally.
+	GoVersion string `json:"go_version,omitempty"`
+
+	// ConfigPath is the path to the configuration file.
+	ConfigPath string `json:"config_path"`
+
+	// ConfigHash is the SHA-256 hash of the loaded configuration file,
+	// or empty if no configuration has been loaded.
+	ConfigHash string `json:"config_hash,omitempty"`
+}
+
+func newVersionInfo(configPath string, current *loadedConfig) versionInfo {
+	info := versionInfo{ConfigPath: configPath}
+	if current != nil {
+		info.ConfigHash = current.Hash
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.Version = build.Main.Version
+	info.GoVersion = build.GoVersion
+	for _, s := range build.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+func serveText(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, body+"\n")
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAdminHandler(t *testing.T, yaml string) (*adminHandler, *reloader) {
+	path := TempFile(t, yaml)
+	templates := getTestTemplates(t, nil)
+	r := newReloader(path, func(c *Config) (http.Handler, error) {
+		return CreateHandler(c, templates)
+	}, log.New(&bytes.Buffer{}, "", 0))
+	return newAdminHandler(r, newMetrics().Handler(), r), r
+}
+
+func TestAdminHandler(t *testing.T) {
+	h, r := newTestAdminHandler(t, `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+`)
+
+	t.Run("before load", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(h, "/healthz").Code)
+		assert.Equal(t, http.StatusServiceUnavailable, serve(h, "/readyz").Code)
+
+		rr := serve(h, "/version")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var info versionInfo
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &info))
+		assert.Equal(t, r.path, info.ConfigPath)
+		assert.Empty(t, info.ConfigHash)
+	})
+
+	require.NoError(t, r.Reload())
+
+	t.Run("after load", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(h, "/healthz").Code)
+
+		rr := serve(h, "/readyz")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "ok\n", rr.Body.String())
+
+		rr = serve(h, "/version")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var info versionInfo
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &info))
+		assert.Equal(t, r.path, info.ConfigPath)
+		assert.Equal(t, r.Current().Hash, info.ConfigHash)
+		assert.NotEmpty(t, info.GoVersion)
+
+		rr = serve(h, "/metrics")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "go_goroutines")
+
+		assert.Equal(t, http.StatusOK, serve(h, "/zap").Code, "packages must still be served")
+	})
+}
+
+func TestAdminHandlerMethods(t *testing.T) {
+	h, r := newTestAdminHandler(t, `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+`)
+	require.NoError(t, r.Reload())
+
+	for _, path := range []string{"/healthz", "/readyz", "/version"} {
+		t.Run(path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodHead, path, nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			rr = httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, nil))
+			assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+			assert.Equal(t, "GET, HEAD, OPTIONS", rr.Header().Get("Allow"))
+		})
+	}
+}
+
+func TestAdminOnlyHandlerMethods(t *testing.T) {
+	templates := getTestTemplates(t, nil)
+	r := newReloader(TempFile(t, `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+`), func(c *Config) (http.Handler, error) {
+		return CreateHandler(c, templates)
+	}, log.New(&bytes.Buffer{}, "", 0))
+	require.NoError(t, r.Reload())
+
+	// Admin-only listeners serve nothing but the admin endpoints.
+	h := newAdminHandler(r, newMetrics().Handler(), http.NotFoundHandler())
+
+	for _, path := range []string{"/healthz", "/readyz", "/version", "/metrics"} {
+		t.Run(path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodHead, path, nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			rr = httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodOptions, path, nil))
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+			assert.Equal(t, "GET, HEAD, OPTIONS", rr.Header().Get("Allow"))
+
+			rr = httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, nil))
+			assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+			assert.Equal(t, "GET, HEAD, OPTIONS", rr.Header().Get("Allow"))
+		})
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(h, "/zap").Code)
+}
+
+func TestListenerHandler(t *testing.T) {
+	templates := getTestTemplates(t, nil)
+	r := newReloader(TempFile(t, `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+`), func(c *Config) (http.Handler, error) {
+		return CreateHandler(c, templates)
+	}, log.New(&bytes.Buffer{}, "", 0))
+	require.NoError(t, r.Reload())
+	m := newMetrics()
+
+	tests := []struct {
+		desc      string
+		give      ListenerConfig
+		wantAdmin bool
+		wantZap   bool
+	}{
+		{desc: "default", wantAdmin: true, wantZap: true},
+		{desc: "admin only", give: ListenerConfig{AdminOnly: true}, wantAdmin: true},
+		{desc: "no admin", give: ListenerConfig{NoAdmin: true}, wantZap: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			h := listenerHandler(tt.give, r, m)
+			for _, path := range []string{"/healthz", "/readyz", "/version", "/metrics"} {
+				assert.Equal(t, tt.wantAdmin, serve(h, path).Code == http.StatusOK, path)
+			}
+			assert.Equal(t, tt.wantZap, serve(h, "/zap").Code == http.StatusOK, "/zap")
+		})
+	}
+}
+
+func TestAdminHandlerCustomPaths(t *testing.T) {
+	h, r := newTestAdminHandler(t, `
+url: go.uber.org
+admin:
+  health_path: /-/health
+  ready_path: /-/ready
+  version_path: /-/version
+  metrics_path: /-/metrics
+packages:
+  healthz:
+    repo: github.com/example/healthz
+`)
+	require.NoError(t, r.Reload())
+
+	assert.Equal(t, http.StatusOK, serve(h, "/-/health").Code)
+	assert.Equal(t, http.StatusOK, serve(h, "/-/ready").Code)
+	assert.Equal(t, http.StatusOK, serve(h, "/-/version").Code)
+	assert.Equal(t, http.StatusOK, serve(h, "/-/metrics").Code)
+
+	rr := serve(h, "/healthz")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `<meta name="go-import" content="go.uber.org/healthz git`)
+}
+
+func TestAdminPathConflicts(t *testing.T) {
+	_, err := Parse(TempFile(t, `
+url: go.uber.org
+admin:
+  ready_path: /zap/ready
+  version_path: info
+packages:
+  healthz:
+    repo: github.com/example/healthz
+  zap:
+    repo: github.com/uber-go/zap
+`))
+	require.Error(t, err)
+	assert.Equal(t, `5:17: admin.version_path must be an absolute path other than '/': "info"
+7:3: package "healthz": name conflicts with admin.health_path "/healthz"
+9:3: package "zap": name conflicts with admin.ready_path "/zap/ready"`, err.Error())
+}
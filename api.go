@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// _apiPackagesPath is the path at which the JSON listing of packages
+// is served.
+const _apiPackagesPath = "/api/packages"
+
+// apiResponse is the body of a successful JSON API response.
+type apiResponse struct {
+	Packages []*sallyPackage `json:"packages"`
+
+	// Patterns are listed only for the root directory.
+	Patterns []*sallyPattern `json:"patterns,omitempty"`
+}
+
+// apiError is the body of a failed JSON API response.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiHandler serves the JSON listing of packages
+// at /api/packages and /api/packages/<prefix>.
+type apiHandler struct {
+	index *indexHandler
+
+	// Handler for requests made by the go command.
+	// The go command requests every prefix of an import path,
+	// so a package named "api", or a pattern matching it,
+	// must still serve "/api/packages?go-get=1".
+	packages http.Handler
+}
+
+var _ http.Handler = (*apiHandler)(nil)
+
+func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isGoGet(r) {
+		h.packages.ServeHTTP(w, r)
+		return
+	}
+
+	annotateRequest(r, "api", nil)
+
+	path := strings.TrimPrefix(r.URL.Path, _apiPackagesPath)
+	h.index.serveJSON(w, strings.Trim(path, "/"))
+}
+
+func (h *indexHandler) serveJSON(w http.ResponseWriter, path string) {
+	start, end := h.rangeOf(path)
+	if start == end && !h.listsPatterns(path) {
+		serveJSON(w, http.StatusNotFound, apiError{
+			Error: fmt.Sprintf("no packages found under %q", path),
+		})
+		return
+	}
+
+	res := apiResponse{Packages: h.pkgs[start:end]}
+	if h.listsPatterns(path) {
+		res.Patterns = h.patterns
+	}
+	serveJSON(w, http.StatusOK, res)
+}
+
+func serveJSON(w http.ResponseWriter, status int, data interface{}) {
+	if status >= 400 {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(data)
+}
+
+// prefersJSON reports whether the request's Accept header
+// prefers a JSON response over an HTML response.
+//
+// HTML wins ties so that clients that accept anything,
+// like browsers and curl, continue to receive HTML.
+func prefersJSON(r *http.Request) bool {
+	var htmlQ, jsonQ float64
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			q := 1.0
+			if v, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					continue
+				}
+			}
+
+			switch mediaType {
+			case "application/json", "application/*":
+				jsonQ = max(jsonQ, q)
+			case "text/html", "text/*", "*/*":
+				htmlQ = max(htmlQ, q)
+			}
+		}
+	}
+	return jsonQ > htmlQ
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIPackages(t *testing.T) {
+	rr := CallAndRecord(t, config, getTestTemplates(t, nil), "/api/packages")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	body := rr.Body.String()
+	assert.JSONEq(t, `{"packages": [
+		{
+			"name": "net/metrics",
+			"module_path": "go.uber.org/net/metrics",
+			"repo": "github.com/yarpc/metrics",
+			"repo_root": "https://github.com/yarpc/metrics",
+			"browse_url": "https://github.com/yarpc/metrics",
+			"issues_url": "https://github.com/yarpc/metrics/issues",
+			"vcs": "git",
+			"doc_url": "https://pkg.go.dev/go.uber.org/net/metrics",
+			"doc_badge": "//pkg.go.dev/badge/go.uber.org/net/metrics.svg"
+		},
+		{
+			"name": "net/something",
+			"module_path": "go.uber.org/net/something",
+			"repo": "github.com/yarpc/something",
+			"repo_root": "https://github.com/yarpc/something",
+			"browse_url": "https://github.com/yarpc/something",
+			"issues_url": "https://github.com/yarpc/something/issues",
+			"vcs": "git",
+			"doc_url": "https://pkg.go.dev/go.uber.org/net/something",
+			"doc_badge": "//pkg.go.dev/badge/go.uber.org/net/something.svg"
+		},
+		{
+			"name": "scago",
+			"module_path": "go.uber.org/scago",
+			"repo": "github.com/m5ka/scago",
+			"repo_root": "https://github.com/m5ka/scago",
+			"browse_url": "https://github.com/m5ka/scago",
+			"issues_url": "https://github.com/m5ka/scago/issues",
+			"vcs": "git",
+			"doc_url": "https://example.org/docs/go-pkg/scago",
+			"doc_badge": "https://img.shields.io/badge/custom_docs-scago-blue?logo=go"
+		},
+		{
+			"name": "thriftrw",
+			"module_path": "go.uber.org/thriftrw",
+			"repo": "github.com/thriftrw/thriftrw-go",
+			"repo_root": "https://github.com/thriftrw/thriftrw-go",
+			"browse_url": "https://github.com/thriftrw/thriftrw-go",
+			"issues_url": "https://github.com/thriftrw/thriftrw-go/issues",
+			"vcs": "git",
+			"doc_url": "https://pkg.go.dev/go.uber.org/thriftrw",
+			"doc_badge": "//pkg.go.dev/badge/go.uber.org/thriftrw.svg"
+		},
+		{
+			"name": "yarpc",
+			"module_path": "go.uber.org/yarpc",
+			"repo": "github.com/yarpc/yarpc-go",
+			"repo_root": "https://github.com/yarpc/yarpc-go",
+			"browse_url": "https://github.com/yarpc/yarpc-go",
+			"issues_url": "https://github.com/yarpc/yarpc-go/issues",
+			"vcs": "git",
+			"doc_url": "https://pkg.go.dev/go.uber.org/yarpc",
+			"doc_badge": "//pkg.go.dev/badge/go.uber.org/yarpc.svg"
+		},
+		{
+			"name": "zap",
+			"module_path": "go.uberalt.org/zap",
+			"repo": "github.com/uber-go/zap",
+			"repo_root": "https://github.com/uber-go/zap",
+			"browse_url": "https://github.com/uber-go/zap",
+			"issues_url": "https://github.com/uber-go/zap/issues",
+			"vcs": "git",
+			"description": "A fast, structured logging library.",
+			"doc_url": "https://pkg.go.dev/go.uberalt.org/zap",
+			"doc_badge": "//pkg.go.dev/badge/go.uberalt.org/zap.svg"
+		}
+	]}`, body)
+}
+
+func TestAPIPackagesPrefix(t *testing.T) {
+	handler := CreateHandlerFromYAML(t, getTestTemplates(t, nil), config)
+
+	t.Run("match", func(t *testing.T) {
+		for _, path := range []string{"/api/packages/net", "/api/packages/net/"} {
+			rr := serve(handler, path)
+			assert.Equal(t, http.StatusOK, rr.Code, path)
+
+			body := rr.Body.String()
+			assert.Contains(t, body, `"name": "net/metrics"`, path)
+			assert.Contains(t, body, `"name": "net/something"`, path)
+			assert.NotContains(t, body, `"name": "zap"`, path)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		rr := serve(handler, "/api/packages/nonexistent")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, "no-cache", rr.Header().Get("Cache-Control"))
+		assert.JSONEq(t, `{"error": "no packages found under \"nonexistent\""}`, rr.Body.String())
+	})
+}
+
+func TestIndexContentNegotiation(t *testing.T) {
+	handler := CreateHandlerFromYAML(t, getTestTemplates(t, nil), config)
+
+	tests := []struct {
+		accept   string
+		wantJSON bool
+	}{
+		{accept: "", wantJSON: false},
+		{accept: "*/*", wantJSON: false},
+		{accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", wantJSON: false},
+		{accept: "application/json", wantJSON: true},
+		{accept: "application/json, text/html;q=0.5", wantJSON: true},
+		{accept: "application/json;q=0.5, text/html", wantJSON: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/net", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "Accept", rr.Header().Get("Vary"))
+			if tt.wantJSON {
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+				assert.Contains(t, rr.Body.String(), `"name": "net/metrics"`)
+			} else {
+				assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestAPIReservedPackageName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "api/packages/zap", wantErr: true},
+		{name: "api/packages", wantErr: true},
+		{name: "api"},
+		{name: "*"},
+		{name: "api/*"},
+		{name: "^ap.*"},
+		{name: "apis"},
+		{name: "api-docs/*"},
+		{name: "^zap.*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(TempFile(t, fmt.Sprintf(`
+url: go.uber.org
+packages:
+  %q:
+    repo: github.com/uber-go/zap
+`, tt.name)))
+			if !tt.wantErr {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "conflicts with the JSON API")
+		})
+	}
+}
+
+func TestAPIPathGoGet(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config string
+		path   string
+	}{
+		{
+			desc: "package",
+			config: `
+url: go.uber.org
+packages:
+  api:
+    repo: github.com/uber-go/api
+`,
+			path: "/api/packages?go-get=1",
+		},
+		{
+			desc: "pattern",
+			config: `
+url: go.uber.org
+packages:
+  "*":
+    repo: github.com/uber-go/{name}
+`,
+			path: "/api/packages/zap?go-get=1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			templates := getTestTemplates(t, nil)
+
+			rr := CallAndRecord(t, tt.config, templates, tt.path)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Contains(t, rr.Body.String(),
+				`<meta name="go-import" content="go.uber.org/api git https://github.com/uber-go/api">`)
+
+			rr = CallAndRecord(t, tt.config, templates, "/api/packages")
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"),
+				"requests without go-get must still reach the API")
+		})
+	}
+}
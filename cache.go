@@ -0,0 +1,93 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// _pageCacheSize is the number of pages rendered on request
+// that are kept for later requests.
+const _pageCacheSize = 1000
+
+// pageKey identifies a page rendered on request.
+type pageKey struct {
+	name    string // package name
+	relPath string // path of the subpackage relative to the package
+	goGet   bool   // whether the page is for the go command
+
+	// Content coding that the page is compressed with, if any.
+	// Pages are compressed only with the encoding that clients asked for.
+	encoding string
+}
+
+// pageCache is a least-recently-used cache of pages
+// that are rendered on request, like those of subpackages.
+//
+// A nil pageCache caches nothing.
+type pageCache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[pageKey]*list.Element // of *pageCacheEntry
+	order   *list.List                // most recently used first
+}
+
+type pageCacheEntry struct {
+	key  pageKey
+	page *page
+}
+
+func newPageCache(size int) *pageCache {
+	return &pageCache{
+		size:    size,
+		entries: make(map[pageKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the cached page for key, or nil if there is none.
+func (c *pageCache) get(key pageKey) *page {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*pageCacheEntry).page
+}
+
+// add caches the page for key,
+// evicting the least recently used page if the cache is full.
+func (c *pageCache) add(key pageKey, p *page) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		// Another request rendered the same page concurrently.
+		e.Value.(*pageCacheEntry).page = p
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&pageCacheEntry{key: key, page: p})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*pageCacheEntry).key)
+	}
+}
+
+// len returns the number of cached pages.
+func (c *pageCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
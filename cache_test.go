@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageCache(t *testing.T) {
+	c := newPageCache(2)
+	a, b, d := pageKey{name: "a"}, pageKey{name: "b"}, pageKey{name: "d"}
+	pa, pb, pd := &page{etag: "a"}, &page{etag: "b"}, &page{etag: "d"}
+
+	assert.Nil(t, c.get(a))
+	c.add(a, pa)
+	c.add(b, pb)
+	assert.Same(t, pa, c.get(a), "a is now the most recently used")
+
+	c.add(d, pd)
+	assert.Equal(t, 2, c.len())
+	assert.Nil(t, c.get(b), "least recently used page must be evicted")
+	assert.Same(t, pa, c.get(a))
+	assert.Same(t, pd, c.get(d))
+
+	c.add(a, pb)
+	assert.Equal(t, 2, c.len())
+	assert.Same(t, pb, c.get(a), "adding an existing key replaces its page")
+}
+
+func TestPageCacheKeys(t *testing.T) {
+	c := newPageCache(10)
+	c.add(pageKey{name: "zap", relPath: "/zapcore", goGet: true}, &page{})
+	assert.Nil(t, c.get(pageKey{name: "zap", relPath: "/zapcore"}))
+	assert.Nil(t, c.get(pageKey{name: "zap", relPath: "/zapcore/"}))
+	assert.Nil(t, c.get(pageKey{name: "zap/zapcore", goGet: true}))
+	assert.Nil(t, c.get(pageKey{name: "zap", relPath: "/zapcore", goGet: true, encoding: "gzip"}))
+	assert.NotNil(t, c.get(pageKey{name: "zap", relPath: "/zapcore", goGet: true}))
+}
+
+func TestPageCacheNil(t *testing.T) {
+	var c *pageCache
+	c.add(pageKey{name: "zap"}, &page{})
+	assert.Nil(t, c.get(pageKey{name: "zap"}))
+}
+
+func TestSubpackagePagesCached(t *testing.T) {
+	templates := getTestTemplates(t, nil)
+	cfg, err := parseConfig([]byte(config))
+	require.NoError(t, err)
+
+	var pkgs []*sallyPackage
+	for name, pkgConfig := range cfg.Packages {
+		pkgs = append(pkgs, newSallyPackage(cfg, name, pkgConfig))
+	}
+	index := newIndexHandler(pkgs, templates.Lookup("index.html"), templates.Lookup("404.html"))
+	index.opts = &pageOptions{cache: newPageCache(10)}
+	h := &packageHandler{pkg: index.pkgs[0], template: templates.Lookup("package.html"), index: index, opts: index.opts}
+	require.NoError(t, h.prerender())
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr
+	}
+
+	name := "/" + h.pkg.Name
+	serve(name)
+	assert.Equal(t, 0, index.opts.cache.len(), "pre-rendered pages must not be cached")
+
+	first := serve(name + "/sub?go-get=1")
+	second := serve(name + "/sub?go-get=1")
+	assert.Equal(t, 1, index.opts.cache.len())
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, first.Header().Get("ETag"), second.Header().Get("ETag"))
+
+	serve(name + "/sub")
+	serve(name + "/other?go-get=1")
+	assert.Equal(t, 3, index.opts.cache.len())
+}
+
+func TestSubpackagePagesCachedByEncoding(t *testing.T) {
+	templates := getTestTemplates(t, map[string]string{
+		"package.html": strings.Repeat("padding ", _compressMinSize) + "{{ .ImportPath }}",
+	})
+	cfg, err := parseConfig([]byte(config))
+	require.NoError(t, err)
+
+	var pkgs []*sallyPackage
+	for name, pkgConfig := range cfg.Packages {
+		pkgs = append(pkgs, newSallyPackage(cfg, name, pkgConfig))
+	}
+	index := newIndexHandler(pkgs, templates.Lookup("index.html"), templates.Lookup("404.html"))
+	index.opts = &pageOptions{cache: newPageCache(10)}
+	h := &packageHandler{pkg: index.pkgs[0], template: templates.Lookup("package.html"), index: index, opts: index.opts}
+
+	for _, enc := range []string{"gzip", "zstd", "gzip", ""} {
+		req := httptest.NewRequest("GET", "/"+h.pkg.Name+"/sub", nil)
+		if enc != "" {
+			req.Header.Set("Accept-Encoding", enc)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, enc, rr.Header().Get("Content-Encoding"))
+	}
+	assert.Equal(t, 3, index.opts.cache.len(), "pages must be cached by encoding")
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	yaml "gopkg.in/yaml.v3"
 )
@@ -21,6 +23,67 @@ type Config struct {
 
 	// Godoc specifies where to redirect to for documentation.
 	Godoc GodocConfig `yaml:"godoc"`
+
+	// BrowserRedirect specifies where package pages send browsers:
+	// "docs" for the documentation, "repo" for the repository,
+	// "none" to stay on the package page, or a custom URL.
+	// Packages may override this.
+	//
+	// Requests made by the go command are never redirected.
+	//
+	// Defaults to docs.
+	BrowserRedirect string `yaml:"browser_redirect"`
+
+	// CacheControl configures the Cache-Control headers
+	// of successful responses.
+	CacheControl CacheControlConfig `yaml:"cache_control"`
+
+	// Admin configures the operational endpoints served by sally.
+	Admin AdminConfig `yaml:"admin"`
+
+	// Server configures the HTTP server.
+	//
+	// Changes to these settings take effect only after a restart.
+	Server ServerConfig `yaml:"server"`
+
+	// Listeners are the addresses to serve on.
+	// The -listen flag overrides these.
+	//
+	// Changes to these settings take effect only after a restart.
+	//
+	// Defaults to a single TCP listener on the port given by -port.
+	Listeners []ListenerConfig `yaml:"listeners"`
+
+	// TLS configures serving over HTTPS.
+	//
+	// Changes to these settings take effect only after a restart.
+	TLS TLSConfig `yaml:"tls"`
+
+	// AccessLog configures logging of requests.
+	AccessLog AccessLogConfig `yaml:"access_log"`
+
+	// Debug includes the errors of pages that fail to render
+	// in the responses to clients. The -debug flag enables this.
+	//
+	// Errors are always logged, and because they can reveal
+	// internal details, this defaults to false.
+	Debug bool `yaml:"debug"`
+
+	// AllowUnknownKeys disables the check for unrecognized keys
+	// in the configuration file.
+	// Use this if the file deliberately holds extra keys,
+	// for example, for other tools.
+	//
+	// Defaults to false, rejecting unknown keys.
+	AllowUnknownKeys bool `yaml:"allow_unknown_keys"`
+
+	// source is the parsed YAML document this configuration was decoded
+	// from, if any. It's used to report positions of invalid fields.
+	source *yaml.Node
+
+	// hash is the hex-encoded SHA-256 hash of the source,
+	// or empty if the configuration wasn't parsed from a file.
+	hash string
 }
 
 // GodocConfig is the configuration for the documentation server.
@@ -31,29 +94,246 @@ type GodocConfig struct {
 	Host string `yaml:"host"`
 }
 
+// CacheControlConfig holds the Cache-Control headers
+// for each kind of successful response.
+// Responses get no Cache-Control header if the corresponding value is empty.
+//
+// Pages carry an ETag and a Last-Modified header,
+// so caches can revalidate them cheaply.
+type CacheControlConfig struct {
+	// Index is the Cache-Control header of index pages.
+	Index string `yaml:"index"`
+
+	// Package is the Cache-Control header of package pages
+	// requested by browsers.
+	Package string `yaml:"package"`
+
+	// GoGet is the Cache-Control header of package pages
+	// requested by the go command with ?go-get=1.
+	GoGet string `yaml:"go_get"`
+}
+
+// AdminConfig configures the operational endpoints served by sally.
+//
+// These paths take precedence over package paths,
+// so they must not overlap with any package name.
+type AdminConfig struct {
+	// HealthPath is the path of the liveness endpoint.
+	// It reports success as long as the server is running.
+	//
+	// Defaults to /healthz.
+	HealthPath string `yaml:"health_path"`
+
+	// ReadyPath is the path of the readiness endpoint.
+	// It reports success once a configuration has been loaded.
+	//
+	// Defaults to /readyz.
+	ReadyPath string `yaml:"ready_path"`
+
+	// VersionPath is the path of the endpoint
+	// reporting build and configuration information.
+	//
+	// Defaults to /version.
+	VersionPath string `yaml:"version_path"`
+
+	// MetricsPath is the path of the endpoint
+	// serving Prometheus metrics.
+	//
+	// Defaults to /metrics.
+	MetricsPath string `yaml:"metrics_path"`
+}
+
+// _defaultAdminConfig holds the default paths for the admin endpoints.
+var _defaultAdminConfig = AdminConfig{
+	HealthPath:  "/healthz",
+	ReadyPath:   "/readyz",
+	VersionPath: "/version",
+	MetricsPath: "/metrics",
+}
+
+// ServerConfig configures the HTTP server.
+// See [http.Server] for details on each setting.
+type ServerConfig struct {
+	// ReadHeaderTimeout is the maximum time to read request headers.
+	//
+	// Defaults to 10 seconds.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+
+	// ReadTimeout is the maximum time to read an entire request.
+	//
+	// Defaults to 30 seconds.
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+
+	// WriteTimeout is the maximum time to write a response.
+	//
+	// Defaults to 30 seconds.
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+
+	// IdleTimeout is the maximum time to wait for the next request
+	// on a keep-alive connection.
+	//
+	// Defaults to 2 minutes.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+
+	// MaxHeaderBytes is the maximum size of request headers.
+	//
+	// Defaults to 1 MB.
+	MaxHeaderBytes int `yaml:"max_header_bytes"`
+
+	// ShutdownTimeout is how long to wait for in-flight requests
+	// to finish when shutting down.
+	//
+	// Defaults to 30 seconds.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// _defaultServerConfig holds the default HTTP server settings.
+var _defaultServerConfig = ServerConfig{
+	ReadHeaderTimeout: 10 * time.Second,
+	ReadTimeout:       30 * time.Second,
+	WriteTimeout:      30 * time.Second,
+	IdleTimeout:       2 * time.Minute,
+	MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+	ShutdownTimeout:   30 * time.Second,
+}
+
+// ListenerConfig configures an address for sally to serve on.
+type ListenerConfig struct {
+	// Addr is the address to listen on. It takes one of these forms:
+	//
+	//	host:port     TCP address; host may be empty for all interfaces
+	//	unix:/path    Unix domain socket at /path
+	//	systemd:name  socket passed by systemd socket activation,
+	//	              selected by its FileDescriptorName= or its index
+	Addr string `yaml:"addr"` // required
+
+	// Mode is the octal file mode of a Unix domain socket, e.g. "0660".
+	Mode string `yaml:"mode"`
+
+	// Owner is the owner of a Unix domain socket as "user[:group]".
+	Owner string `yaml:"owner"`
+
+	// AdminOnly restricts this listener to the admin endpoints
+	// configured in [AdminConfig], without serving any packages.
+	AdminOnly bool `yaml:"admin_only"`
+
+	// NoAdmin serves only packages on this listener,
+	// without the admin endpoints.
+	// Use this with an admin-only listener
+	// to keep metrics and version information off public addresses.
+	NoAdmin bool `yaml:"no_admin"`
+
+	// Plaintext serves plain HTTP on this listener
+	// even if TLS is configured.
+	Plaintext bool `yaml:"plaintext"`
+}
+
+// TLSConfig configures serving over HTTPS.
+// TLS is enabled if a certificate and key are provided.
+type TLSConfig struct {
+	// CertFile is the path to a PEM-encoded certificate chain.
+	// The certificate is reloaded when the file changes.
+	CertFile string `yaml:"cert_file"`
+
+	// KeyFile is the path to the PEM-encoded private key
+	// for the certificate.
+	KeyFile string `yaml:"key_file"`
+
+	// MinVersion is the minimum TLS version to accept:
+	// "1.0", "1.1", "1.2", or "1.3".
+	//
+	// Defaults to 1.2.
+	MinVersion string `yaml:"min_version"`
+
+	// RedirectAddr is the address of an optional plain HTTP listener
+	// that redirects all requests to HTTPS.
+	// For example, ":80".
+	RedirectAddr string `yaml:"redirect_addr"`
+}
+
+// AccessLogConfig configures logging of requests.
+type AccessLogConfig struct {
+	// Enabled turns on access logging.
+	// If enabled, sally logs one line per request to stderr.
+	Enabled bool `yaml:"enabled"`
+
+	// Format is the format of log lines: "text" or "json".
+	//
+	// Defaults to text.
+	Format string `yaml:"format"`
+
+	// SampleRate is the fraction of requests to log,
+	// between 0 (exclusive) and 1 (inclusive).
+	//
+	// Defaults to 1, logging every request.
+	SampleRate float64 `yaml:"sample_rate"`
+
+	// TrustedProxies is a list of IP addresses and CIDR ranges
+	// of reverse proxies in front of sally.
+	// For requests from these addresses, the client address is taken
+	// from the X-Forwarded-For or X-Real-IP headers.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
 // PackageConfig is the configuration for a single Go module
 // that is served by Sally.
 type PackageConfig struct {
-	// Repo is the URL to the Git repository for the module
+	// Repo is the URL to the repository for the module
 	// without the https:// prefix.
-	// This URL must serve the Git HTTPS protocol.
+	// This URL must serve the HTTPS protocol of the module's VCS,
+	// or the GOPROXY protocol if VCS is "mod".
 	//
 	// For example, "github.com/uber-go/sally".
 	Repo string `yaml:"repo"` // required
 
+	// Subdir is the directory inside the repository
+	// that holds the module, if it's not at the repository root.
+	// It's served as the fourth field of the go-import meta tag,
+	// which requires Go 1.25 or newer.
+	//
+	// For example, "tools" for a module in the tools/ directory.
+	Subdir string `yaml:"subdir"`
+
 	// URL is the base URL of the vanity import for this module.
 	//
 	// Defaults to the URL specified in the top-level config.
 	URL string `yaml:"url"`
 
-	// VCS is the version control system of this module.
+	// VCS is the version control system of this module:
+	// one of "git", "hg", "svn", "bzr", or "fossil",
+	// or "mod" if Repo is a module proxy.
 	//
 	// Defaults to git.
 	VCS string `yaml:"vcs"`
 
+	// Origin is the version control repository of a module
+	// served from a module proxy.
+	// If set, it's served alongside the proxy for clients
+	// that fetch modules directly from version control.
+	//
+	// Only valid if VCS is "mod".
+	Origin OriginConfig `yaml:"origin"`
+
 	// Desc is a plain text description of this module.
 	Desc string `yaml:"description"`
 
+	// BrowseURL is the URL at which the repository
+	// can be viewed in a browser.
+	//
+	// Defaults to the canonical URL of the repository
+	// on well-known hosts like github.com,
+	// and to the repository URL otherwise.
+	BrowseURL string `yaml:"browse_url"`
+
+	// Homepage is the URL of the module's website, if any.
+	Homepage string `yaml:"homepage"`
+
+	// IssuesURL is the URL of the module's issue tracker.
+	//
+	// Defaults to the repository's issue tracker
+	// on well-known hosts like github.com.
+	IssuesURL string `yaml:"issues_url"`
+
 	// DocURL is the link to this module's documentation.
 	//
 	// Defaults to the base doc URL specified in the top-level config
@@ -66,18 +346,83 @@ type PackageConfig struct {
 	// Defaults to the pkg.go.dev badge URL with this module's path as a
 	// parameter.
 	DocBadge string `yaml:"doc_badge"`
+
+	// BrowserRedirect overrides the top-level BrowserRedirect
+	// for this module.
+	BrowserRedirect string `yaml:"browser_redirect"`
+
+	// MovedTo is the module path that this module has moved to,
+	// without the https:// prefix.
+	//
+	// If set, browsers are permanently redirected to the new path,
+	// while the go command continues to receive go-import metadata
+	// for the old module path so that existing go.mod files keep working.
+	//
+	// For example, "go.uber.org/zap/v2".
+	MovedTo string `yaml:"moved_to"`
+
+	// Status marks the module as no longer recommended for use.
+	// It's either "deprecated" or "archived".
+	// Archived modules are hidden from the index page by default.
+	//
+	// Defaults to empty, for modules in active use.
+	Status string `yaml:"status"`
+
+	// StatusMessage is a plain text explanation of the status.
+	StatusMessage string `yaml:"status_message"`
+
+	// Replacement is the import path of a module to use instead
+	// of a deprecated or archived module,
+	// without the https:// prefix.
+	Replacement string `yaml:"replacement"`
+}
+
+// OriginConfig is the version control repository
+// of a module served from a module proxy.
+type OriginConfig struct {
+	// Repo is the URL to the repository without the https:// prefix.
+	Repo string `yaml:"repo"`
+
+	// VCS is the version control system of the repository.
+	// It must not be "mod".
+	//
+	// Defaults to git.
+	VCS string `yaml:"vcs"`
 }
 
+// Values for browser_redirect other than a custom URL.
+const (
+	_redirectDocs = "docs"
+	_redirectRepo = "repo"
+	_redirectNone = "none"
+)
+
+// Values for PackageConfig.Status.
+const (
+	_statusDeprecated = "deprecated"
+	_statusArchived   = "archived"
+)
+
 // Parse takes a path to a yaml file and produces a parsed Config
 func Parse(path string) (*Config, error) {
-	var c Config
-
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := yaml.Unmarshal(data, &c); err != nil {
+	return parseConfig(data)
+}
+
+// parseConfig produces a parsed and validated Config
+// from the contents of a yaml file.
+func parseConfig(data []byte) (*Config, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	c := Config{source: &root, hash: hashConfig(data)}
+	if err := root.Decode(&c); err != nil {
 		return nil, err
 	}
 
@@ -91,14 +436,64 @@ func Parse(path string) (*Config, error) {
 		c.Godoc.Host = host
 	}
 
+	if c.Admin.HealthPath == "" {
+		c.Admin.HealthPath = _defaultAdminConfig.HealthPath
+	}
+	if c.Admin.ReadyPath == "" {
+		c.Admin.ReadyPath = _defaultAdminConfig.ReadyPath
+	}
+	if c.Admin.VersionPath == "" {
+		c.Admin.VersionPath = _defaultAdminConfig.VersionPath
+	}
+	if c.Admin.MetricsPath == "" {
+		c.Admin.MetricsPath = _defaultAdminConfig.MetricsPath
+	}
+
+	if c.Server.ReadHeaderTimeout == 0 {
+		c.Server.ReadHeaderTimeout = _defaultServerConfig.ReadHeaderTimeout
+	}
+	if c.Server.ReadTimeout == 0 {
+		c.Server.ReadTimeout = _defaultServerConfig.ReadTimeout
+	}
+	if c.Server.WriteTimeout == 0 {
+		c.Server.WriteTimeout = _defaultServerConfig.WriteTimeout
+	}
+	if c.Server.IdleTimeout == 0 {
+		c.Server.IdleTimeout = _defaultServerConfig.IdleTimeout
+	}
+	if c.Server.MaxHeaderBytes == 0 {
+		c.Server.MaxHeaderBytes = _defaultServerConfig.MaxHeaderBytes
+	}
+	if c.Server.ShutdownTimeout == 0 {
+		c.Server.ShutdownTimeout = _defaultServerConfig.ShutdownTimeout
+	}
+
+	if c.AccessLog.Format == "" {
+		c.AccessLog.Format = "text"
+	}
+	if c.AccessLog.SampleRate == 0 {
+		c.AccessLog.SampleRate = 1
+	}
+
+	if c.BrowserRedirect == "" {
+		c.BrowserRedirect = _redirectDocs
+	}
+
 	// Set default values for the packages.
 	for name, pkg := range c.Packages {
 		if pkg.VCS == "" {
 			pkg.VCS = "git"
 		}
+		if pkg.Origin.Repo != "" && pkg.Origin.VCS == "" {
+			pkg.Origin.VCS = "git"
+		}
 
 		c.Packages[name] = pkg
 	}
 
-	return &c, err
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
 }
@@ -14,8 +14,7 @@ func TestParse(t *testing.T) {
 url: google.golang.org
 packages:
   grpc:
-    repo: github.com/grpc/grpc-go
-    branch: main
+    repo: svn.example.com/grpc/grpc-go
     vcs: svn
 
 `)
@@ -28,7 +27,7 @@ packages:
 
 	pkg, ok := config.Packages["grpc"]
 	assert.True(t, ok)
-	assert.Equal(t, PackageConfig{Repo: "github.com/grpc/grpc-go", VCS: "svn"}, pkg)
+	assert.Equal(t, PackageConfig{Repo: "svn.example.com/grpc/grpc-go", VCS: "svn"}, pkg)
 }
 
 func TestParsePackageLevelURL(t *testing.T) {
@@ -84,3 +83,40 @@ packages:
 		})
 	}
 }
+
+func TestParseUnknownKeys(t *testing.T) {
+	path := TempFile(t, `
+url: google.golang.org
+godoc:
+  hostname: example.com
+packages:
+  grpc:
+    repo: github.com/grpc/grpc-go
+    branch: main
+    descripton: The Go language implementation of gRPC.
+`)
+
+	_, err := Parse(path)
+	require.Error(t, err)
+	assert.Equal(t, `4:3: unknown key "hostname" in "godoc"
+8:5: unknown key "branch" in "packages.grpc"
+9:5: unknown key "descripton" in "packages.grpc"`, err.Error())
+}
+
+func TestParseAllowUnknownKeys(t *testing.T) {
+	path := TempFile(t, `
+allow_unknown_keys: true
+url: google.golang.org
+packages:
+  grpc:
+    repo: github.com/grpc/grpc-go
+    branch: main
+`)
+
+	config, err := Parse(path)
+	require.NoError(t, err)
+
+	pkg, ok := config.Packages["grpc"]
+	assert.True(t, ok)
+	assert.Equal(t, PackageConfig{Repo: "github.com/grpc/grpc-go", VCS: "git"}, pkg)
+}
@@ -4,11 +4,13 @@ import (
 	"cmp"
 	"embed"
 	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
 	"path"
 	"slices"
 	"strings"
+	"time"
 )
 
 var (
@@ -20,7 +22,8 @@ var (
 
 // CreateHandler builds a new handler with the provided package configuration,
 // and templates. The templates object must contain the following: index.html,
-// package.html, and 404.html. The returned handler provides the following
+// package.html, and 404.html. It may also contain 500.html, which is shown
+// for pages that fail to render. The returned handler provides the following
 // endpoints:
 //
 //	GET /
@@ -32,6 +35,27 @@ var (
 //		assuming that there's no package with the given name.
 //	GET /<name>/<subpkg>
 //		Package page for the given subpackage.
+//		Browsers are redirected to the new path of packages that have moved.
+//	GET /<match>
+//		Package page for a name matching a pattern entry,
+//		assuming that there's no package or directory with the given name.
+//	GET /api/packages
+//		JSON listing of all packages.
+//	GET /api/packages/<dir>
+//		JSON listing of packages under the given directory.
+//
+// Requests for index pages that prefer application/json
+// in their Accept header receive the JSON listing instead of HTML.
+//
+// HEAD requests are answered like GET requests without a body,
+// and OPTIONS requests with the allowed methods.
+// Other methods are rejected with 405 Method Not Allowed.
+//
+// Index pages and the pages of configured packages are rendered
+// ahead of time, so CreateHandler fails if the templates do.
+// Pages for subpackages and pattern matches are rendered on request
+// and cached, and respond with 500 Internal Server Error
+// if the templates fail.
 func CreateHandler(config *Config, templates *template.Template) (http.Handler, error) {
 	indexTemplate := templates.Lookup("index.html")
 	if indexTemplate == nil {
@@ -50,54 +74,143 @@ func CreateHandler(config *Config, templates *template.Template) (http.Handler,
 
 	mux := http.NewServeMux()
 	pkgs := make([]*sallyPackage, 0, len(config.Packages))
-	for name, pkg := range config.Packages {
-		baseURL := config.URL
-		if pkg.URL != "" {
-			// Package-specific override for the base URL.
-			baseURL = pkg.URL
+	var patterns []*sallyPattern
+	for name, pkgConfig := range config.Packages {
+		if isPattern(name) {
+			pattern, err := newSallyPattern(config, name, pkgConfig)
+			if err != nil {
+				return nil, err
+			}
+			patterns = append(patterns, pattern)
+			continue
 		}
-		modulePath := path.Join(baseURL, name)
 
-		docURL := pkg.DocURL
-		if docURL == "" {
-			docURL = "https://" + path.Join(config.Godoc.Host, modulePath)
-		}
+		pkgs = append(pkgs, newSallyPackage(config, name, pkgConfig))
+	}
+	sortPatterns(patterns)
+
+	opts := &pageOptions{
+		cacheControl:  config.CacheControl,
+		version:       config.hash,
+		modTime:       time.Now(),
+		cache:         newPageCache(_pageCacheSize),
+		errorTemplate: templates.Lookup("500.html"),
+		debug:         config.Debug,
+	}
+
+	index := newIndexHandler(pkgs, indexTemplate, notFoundTemplate)
+	index.patterns = patterns
+	index.packageTemplate = packageTemplate
+	index.opts = opts
 
-		docBadge := pkg.DocBadge
-		if docBadge == "" {
-			docBadge = "//pkg.go.dev/badge/" + modulePath + ".svg"
+	router := &packageRouter{
+		index:    index,
+		packages: make([]*packageHandler, len(index.pkgs)),
+	}
+	for i, pkg := range index.pkgs {
+		handler := &packageHandler{pkg: pkg, template: packageTemplate, index: index, opts: opts}
+		if err := handler.prerender(); err != nil {
+			return nil, fmt.Errorf("package %q: %w", pkg.Name, err)
 		}
+		router.packages[i] = handler
+	}
+	if err := index.prerender(); err != nil {
+		return nil, err
+	}
+	mux.Handle("/", router)
+	api := &apiHandler{index: index, packages: router}
+	mux.Handle(_apiPackagesPath, api)
+	mux.Handle(_apiPackagesPath+"/", api)
+	return allowReadMethods(mux), nil
+}
 
-		pkg := &sallyPackage{
-			Name:       name,
-			Desc:       pkg.Desc,
-			ModulePath: modulePath,
-			DocURL:     docURL,
-			DocBadge:   docBadge,
-			VCS:        pkg.VCS,
-			RepoURL:    pkg.Repo,
+// newSallyPackage builds the package served for the given name,
+// filling in defaults for unset fields.
+func newSallyPackage(config *Config, name string, pkg PackageConfig) *sallyPackage {
+	baseURL := config.URL
+	if pkg.URL != "" {
+		// Package-specific override for the base URL.
+		baseURL = pkg.URL
+	}
+	modulePath := path.Join(baseURL, name)
+
+	docURL := pkg.DocURL
+	if docURL == "" {
+		docURL = "https://" + path.Join(config.Godoc.Host, modulePath)
+	}
+
+	docBadge := pkg.DocBadge
+	if docBadge == "" {
+		docBadge = "//pkg.go.dev/badge/" + modulePath + ".svg"
+	}
+
+	// Link to the version control repository rather than a module proxy.
+	linkRepo := pkg.Repo
+	var origin *sallyOrigin
+	if pkg.Origin.Repo != "" {
+		linkRepo = pkg.Origin.Repo
+		origin = &sallyOrigin{
+			VCS:       pkg.Origin.VCS,
+			RepoURL:   pkg.Origin.Repo,
+			RepoRoot:  repoRoot(pkg.Origin.Repo),
+			BrowseURL: browseURL(pkg.Origin.Repo),
 		}
-		pkgs = append(pkgs, pkg)
+	}
 
-		// Double-register so that "/foo"
-		// does not redirect to "/foo/" with a 300.
-		handler := &packageHandler{pkg: pkg, template: packageTemplate}
-		mux.Handle("/"+name, handler)
-		mux.Handle("/"+name+"/", handler)
+	return &sallyPackage{
+		Name:       name,
+		Desc:       pkg.Desc,
+		ModulePath: modulePath,
+		DocURL:     docURL,
+		DocBadge:   docBadge,
+		VCS:        pkg.VCS,
+		RepoURL:    pkg.Repo,
+		RepoRoot:   repoRoot(pkg.Repo),
+		BrowseURL:  cmp.Or(pkg.BrowseURL, browseURL(linkRepo)),
+		Homepage:   pkg.Homepage,
+		IssuesURL:  cmp.Or(pkg.IssuesURL, issuesURL(linkRepo)),
+		Subdir:     pkg.Subdir,
+		Origin:     origin,
+		MovedTo:    pkg.MovedTo,
+
+		Status:         pkg.Status,
+		StatusMessage:  pkg.StatusMessage,
+		Replacement:    pkg.Replacement,
+		ReplacementURL: importPathURL(pkg.Replacement),
+
+		browserRedirect: cmp.Or(pkg.BrowserRedirect, config.BrowserRedirect, _redirectDocs),
 	}
+}
 
-	mux.Handle("/", newIndexHandler(pkgs, indexTemplate, notFoundTemplate))
-	return requireMethod(http.MethodGet, mux), nil
+// importPathURL returns the https URL for an import path
+// if its first element is a domain name, or an empty string otherwise,
+// like for standard library packages such as "errors".
+func importPathURL(importPath string) string {
+	host, _, _ := strings.Cut(importPath, "/")
+	if !strings.Contains(host, ".") {
+		return ""
+	}
+	return "https://" + importPath
 }
 
-func requireMethod(method string, handler http.Handler) http.Handler {
+// _allowedMethods is the value of the Allow header
+// for all resources served by sally.
+const _allowedMethods = "GET, HEAD, OPTIONS"
+
+// allowReadMethods serves GET and HEAD requests with the given handler.
+// The http.Server omits the body of responses to HEAD requests.
+func allowReadMethods(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != method {
-			http.NotFound(w, r)
-			return
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handler.ServeHTTP(w, r)
+		case http.MethodOptions:
+			w.Header().Set("Allow", _allowedMethods)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", _allowedMethods)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 		}
-
-		handler.ServeHTTP(w, r)
 	})
 }
 
@@ -105,132 +218,391 @@ type sallyPackage struct {
 	// Name of the package.
 	//
 	// This is the part after the base URL.
-	Name string
+	Name string `json:"name"`
 
 	// Canonical import path for the package.
-	ModulePath string
+	ModulePath string `json:"module_path"`
 
 	// Description of the package, if any.
-	Desc string
+	Desc string `json:"description,omitempty"`
 
 	// URL at which documentation for the package can be found.
-	DocURL string
+	DocURL string `json:"doc_url"`
 
 	// URL at which documentation badge image can be found.
-	DocBadge string
+	DocBadge string `json:"doc_badge"`
 
 	// Version control system used by the package.
-	VCS string
+	VCS string `json:"vcs"`
+
+	// URL at which the repository is hosted, as configured.
+	// This may omit the scheme.
+	RepoURL string `json:"repo"`
+
+	// Repository URL including the scheme, as served to the go command.
+	RepoRoot string `json:"repo_root"`
+
+	// URL at which the repository can be viewed in a browser.
+	//
+	// For packages served from a module proxy,
+	// this refers to the origin repository, if any.
+	BrowseURL string `json:"browse_url"`
 
-	// URL at which the repository is hosted.
-	RepoURL string
+	// URL of the package's website, if any.
+	Homepage string `json:"homepage,omitempty"`
+
+	// URL of the package's issue tracker, if known.
+	IssuesURL string `json:"issues_url,omitempty"`
+
+	// Directory inside the repository holding the module, if any.
+	Subdir string `json:"subdir,omitempty"`
+
+	// Version control repository of a module served from a module proxy,
+	// if any.
+	Origin *sallyOrigin `json:"origin,omitempty"`
+
+	// Module path that the package has moved to, if any.
+	MovedTo string `json:"moved_to,omitempty"`
+
+	// Whether the package is deprecated or archived, if either.
+	Status string `json:"status,omitempty"`
+
+	// Explanation of the status, if any.
+	StatusMessage string `json:"status_message,omitempty"`
+
+	// Import path of the module to use instead, if any.
+	Replacement string `json:"replacement,omitempty"`
+
+	// URL to link to for Replacement, if it has one.
+	ReplacementURL string `json:"-"`
+
+	// Where browsers are sent from the package page.
+	// See Config.BrowserRedirect.
+	browserRedirect string
+
+	// Pattern entry that this package was resolved from, if any.
+	pattern string
+}
+
+// sallyOrigin is the version control repository
+// of a package served from a module proxy.
+type sallyOrigin struct {
+	VCS       string `json:"vcs"`
+	RepoURL   string `json:"repo"`
+	RepoRoot  string `json:"repo_root"`
+	BrowseURL string `json:"browse_url"`
 }
 
 type indexHandler struct {
-	pkgs             []*sallyPackage // sorted by name
+	pkgs             []*sallyPackage // sorted by comparePackageNames
+	tree             *packageTree    // of pkgs
+	patterns         []*sallyPattern // in the order they're tried
 	indexTemplate    *template.Template
 	notFoundTemplate *template.Template
-}
+	packageTemplate  *template.Template
+	opts             *pageOptions
 
-var _ http.Handler = (*indexHandler)(nil)
+	// Pre-rendered index pages by directory, if any.
+	// "" is the root index.
+	pages map[string]*page
+}
 
 func newIndexHandler(pkgs []*sallyPackage, indexTemplate, notFoundTemplate *template.Template) *indexHandler {
 	slices.SortFunc(pkgs, func(a, b *sallyPackage) int {
-		return cmp.Compare(a.Name, b.Name)
+		return comparePackageNames(a.Name, b.Name)
 	})
 
+	names := make([]string, len(pkgs))
+	for i, pkg := range pkgs {
+		names[i] = pkg.Name
+	}
+
 	return &indexHandler{
 		pkgs:             pkgs,
+		tree:             newPackageTree(names),
 		indexTemplate:    indexTemplate,
 		notFoundTemplate: notFoundTemplate,
 	}
 }
 
+// rangeOf returns the range of h.pkgs holding the package with the given name
+// and the packages under it.
 func (h *indexHandler) rangeOf(path string) (start, end int) {
-	if len(path) == 0 {
-		return 0, len(h.pkgs)
+	n := h.tree.find(path)
+	if n == nil {
+		return 0, 0
 	}
+	return n.start, n.end
+}
 
-	// If the packages are sorted by name,
-	// we can scan adjacent packages to find the range of packages
-	// whose name descends from path.
-	start, _ = slices.BinarySearchFunc(h.pkgs, path, func(pkg *sallyPackage, path string) int {
-		return cmp.Compare(pkg.Name, path)
-	})
-
-	for idx := start; idx < len(h.pkgs); idx++ {
-		if !descends(path, h.pkgs[idx].Name) {
-			// End of matching sequences.
-			// The next path is not a descendant of path.
-			return start, idx
+// serveDir serves the index of path, which holds h.pkgs[start:end].
+func (h *indexHandler) serveDir(w http.ResponseWriter, r *http.Request, path string, start, end int) {
+	// Patterns only apply to paths not claimed by explicit packages
+	// or by directories containing them.
+	if start == end && path != "" {
+		if pkg := matchPattern(h.patterns, h.tree, path); pkg != nil {
+			(&packageHandler{pkg: pkg, template: h.packageTemplate, index: h, opts: h.opts}).ServeHTTP(w, r)
+			return
 		}
 	}
 
-	// All packages following start are descendants of path.
-	// Return the rest of the packages.
-	return start, len(h.pkgs)
-}
+	annotateRequest(r, "index", nil)
+	w.Header().Add("Vary", "Accept")
+	if prefersJSON(r) {
+		h.serveJSON(w, path)
+		return
+	}
 
-func (h *indexHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	path := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/"), "/")
-	start, end := h.rangeOf(path)
+	if page, ok := h.pages[path]; ok {
+		page.serve(w, r, h.opts.cacheControl.Index)
+		return
+	}
 
-	// If start == end, then there are no packages
-	if start == end {
-		serveHTML(w, http.StatusNotFound, h.notFoundTemplate, struct{ Path string }{
+	// If start == end, then there are no packages,
+	// though the root index still lists patterns.
+	if start == end && !h.listsPatterns(path) {
+		h.opts.serveHTML(w, http.StatusNotFound, h.notFoundTemplate, struct{ Path string }{
 			Path: path,
 		})
 		return
 	}
 
-	serveHTML(w, http.StatusOK, h.indexTemplate, struct{ Packages []*sallyPackage }{
-		Packages: h.pkgs[start:end],
+	h.opts.serveHTML(w, http.StatusOK, h.indexTemplate, h.data(path, start, end))
+}
+
+// indexData is the data passed to the index template.
+type indexData struct {
+	Packages []*sallyPackage
+	Archived []*sallyPackage
+	Patterns []*sallyPattern
+}
+
+// data returns the data for the index of path,
+// listing the packages in h.pkgs[start:end].
+func (h *indexHandler) data(path string, start, end int) *indexData {
+	// Archived packages are listed separately
+	// so that the index can hide them by default.
+	var data indexData
+	for _, pkg := range h.pkgs[start:end] {
+		if pkg.Status == _statusArchived {
+			data.Archived = append(data.Archived, pkg)
+		} else {
+			data.Packages = append(data.Packages, pkg)
+		}
+	}
+	if h.listsPatterns(path) {
+		data.Patterns = h.patterns
+	}
+	return &data
+}
+
+// prerender renders the root index
+// and the index of every directory containing packages.
+func (h *indexHandler) prerender() (err error) {
+	h.pages = make(map[string]*page)
+	h.tree.walk(func(dir string, n *packageNode) {
+		// Requests for packages are served by the package,
+		// not by the index.
+		if err != nil || n.pkg >= 0 {
+			return
+		}
+
+		var page *page
+		page, err = h.opts.prerender(h.indexTemplate, h.data(dir, n.start, n.end))
+		if err != nil {
+			err = fmt.Errorf("index of %q: %w", dir, err)
+			return
+		}
+		h.pages[dir] = page
 	})
+	return err
+}
+
+// listsPatterns reports whether the index for path lists pattern entries.
+// Patterns are listed only on the root index.
+func (h *indexHandler) listsPatterns(path string) bool {
+	return path == "" && len(h.patterns) > 0
 }
 
 type packageHandler struct {
 	pkg      *sallyPackage
 	template *template.Template
+	index    *indexHandler // for related packages
+	opts     *pageOptions
+
+	// Pre-rendered pages for the package itself, if any,
+	// for the go command and for browsers.
+	goGetPage, browserPage *page
 }
 
 var _ http.Handler = (*packageHandler)(nil)
 
 func (h *packageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	annotateRequest(r, "package", h.pkg)
+
 	// Extract the relative path to subpackages, if any.
 	//      "/foo/bar" => "/bar"
 	//      "/foo" => ""
 	relPath := strings.TrimPrefix(r.URL.Path, "/"+h.pkg.Name)
 
-	serveHTML(w, http.StatusOK, h.template, struct {
-		ModulePath string
-		VCS        string
-		RepoURL    string
-		DocURL     string
-	}{
-		ModulePath: h.pkg.ModulePath,
-		VCS:        h.pkg.VCS,
-		RepoURL:    h.pkg.RepoURL,
-		DocURL:     h.pkg.DocURL + relPath,
-	})
+	// The go command still needs the metadata for the old module path
+	// to fetch versions required by existing go.mod files.
+	if h.pkg.MovedTo != "" && !isGoGet(r) {
+		http.Redirect(w, r, "https://"+h.pkg.MovedTo+relPath, http.StatusMovedPermanently)
+		return
+	}
+
+	goGet := isGoGet(r)
+	cacheControl := h.opts.cacheControl.Package
+	if goGet {
+		cacheControl = h.opts.cacheControl.GoGet
+	}
+
+	if relPath == "" {
+		page := h.browserPage
+		if goGet {
+			page = h.goGetPage
+		}
+		if page != nil {
+			page.serve(w, r, cacheControl)
+			return
+		}
+	}
+
+	// Pages for subpackages depend only on the path,
+	// and the go command requests them for every "go get".
+	key := pageKey{name: h.pkg.Name, relPath: relPath, goGet: goGet}
+	enc := negotiateEncoding(r)
+	if enc != nil {
+		key.encoding = enc.name
+	}
+	page := h.opts.cache.get(key)
+	if page == nil {
+		var err error
+		page, err = h.opts.render(h.template, h.data(relPath, goGet))
+		if err != nil {
+			h.opts.serveError(w, h.template, err)
+			return
+		}
+		// Compress only with the encoding this client wants.
+		if enc != nil {
+			page.compress(*enc)
+		}
+		h.opts.cache.add(key, page)
+	}
+	page.serve(w, r, cacheControl)
 }
 
-func descends(from, to string) bool {
-	return to == from || (strings.HasPrefix(to, from) && to[len(from)] == '/')
+// packageData is the data passed to the package template.
+type packageData struct {
+	ModulePath     string
+	ImportPath     string
+	Subpackage     string
+	Desc           string
+	VCS            string
+	RepoURL        string
+	RepoRoot       string
+	BrowseURL      string
+	Subdir         string
+	Origin         *sallyOrigin
+	DocURL         string
+	RedirectURL    string
+	Detail         bool
+	Homepage       string
+	IssuesURL      string
+	Related        []*sallyPackage
+	Status         string
+	StatusMessage  string
+	Replacement    string
+	ReplacementURL string
+}
+
+// data returns the data for the page of the given subpackage.
+func (h *packageHandler) data(relPath string, goGet bool) *packageData {
+	// The go command only needs the go-import metadata.
+	// Browsers that aren't redirected get the package detail page.
+	var (
+		redirectURL string
+		detail      bool
+	)
+	if !goGet {
+		redirectURL = h.redirectURL(relPath)
+		detail = redirectURL == ""
+	}
+
+	var related []*sallyPackage
+	if detail {
+		related = h.related()
+	}
+
+	return &packageData{
+		ModulePath:     h.pkg.ModulePath,
+		ImportPath:     h.pkg.ModulePath + strings.TrimSuffix(relPath, "/"),
+		Subpackage:     strings.Trim(relPath, "/"),
+		Desc:           h.pkg.Desc,
+		VCS:            h.pkg.VCS,
+		RepoURL:        h.pkg.RepoURL,
+		RepoRoot:       h.pkg.RepoRoot,
+		BrowseURL:      h.pkg.BrowseURL,
+		Subdir:         h.pkg.Subdir,
+		Origin:         h.pkg.Origin,
+		DocURL:         h.pkg.DocURL + relPath,
+		RedirectURL:    redirectURL,
+		Detail:         detail,
+		Homepage:       h.pkg.Homepage,
+		IssuesURL:      h.pkg.IssuesURL,
+		Related:        related,
+		Status:         h.pkg.Status,
+		StatusMessage:  h.pkg.StatusMessage,
+		Replacement:    h.pkg.Replacement,
+		ReplacementURL: h.pkg.ReplacementURL,
+	}
 }
 
-func serveHTML(w http.ResponseWriter, status int, template *template.Template, data interface{}) {
-	if status >= 400 {
-		w.Header().Set("Cache-Control", "no-cache")
+// prerender renders the pages for the package itself.
+// Moved packages redirect browsers, so only the go command gets a page.
+func (h *packageHandler) prerender() (err error) {
+	h.goGetPage, err = h.opts.prerender(h.template, h.data("", true))
+	if err != nil || h.pkg.MovedTo != "" {
+		return err
 	}
+	h.browserPage, err = h.opts.prerender(h.template, h.data("", false))
+	return err
+}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(status)
+// related returns other packages in the same directory as this package,
+// excluding archived packages.
+func (h *packageHandler) related() []*sallyPackage {
+	dir := path.Dir(h.pkg.Name)
+	if dir == "." || h.index == nil {
+		return nil
+	}
 
-	err := template.Execute(w, data)
-	if err != nil {
-		// The status has already been sent, so we cannot use [http.Error] - otherwise
-		// we'll get a superfluous call warning. The other option is to execute the template
-		// to a temporary buffer, but memory.
-		_, _ = w.Write([]byte(err.Error()))
+	var related []*sallyPackage
+	start, end := h.index.rangeOf(dir)
+	for _, pkg := range h.index.pkgs[start:end] {
+		if pkg.Name != h.pkg.Name && pkg.Status != _statusArchived {
+			related = append(related, pkg)
+		}
 	}
+	return related
+}
+
+// redirectURL returns the URL that browsers are sent to from the page
+// for the given subpackage, or an empty string to stay on the page.
+func (h *packageHandler) redirectURL(relPath string) string {
+	switch h.pkg.browserRedirect {
+	case _redirectDocs:
+		return h.pkg.DocURL + relPath
+	case _redirectRepo:
+		return h.pkg.BrowseURL
+	case _redirectNone:
+		return ""
+	default:
+		return h.pkg.browserRedirect
+	}
+}
+
+func descends(from, to string) bool {
+	return to == from || (strings.HasPrefix(to, from) && to[len(from)] == '/')
 }
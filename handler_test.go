@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"html/template"
 	"io"
 	"net/http"
@@ -230,6 +231,431 @@ func TestCustomDocBadge(t *testing.T) {
 	assert.NotContains(t, body, "<img src=\"//pkg.go.dev/badge/go.uber.org/scago.svg\" alt=\"Go Reference\" />")
 }
 
+func TestSubdir(t *testing.T) {
+	rr := CallAndRecord(t, `
+url: go.uber.org
+packages:
+  zap/exp:
+    repo: github.com/uber-go/zap
+    subdir: exp
+`, getTestTemplates(t, nil), "/zap/exp")
+	AssertResponse(t, rr, 200, `
+<!DOCTYPE html>
+<html>
+    <head>
+        <meta name="go-import" content="go.uber.org/zap/exp git https://github.com/uber-go/zap exp">
+        <meta http-equiv="refresh" content="0; url=https://pkg.go.dev/go.uber.org/zap/exp">
+        <style>
+            @media (prefers-color-scheme: dark) {
+                body { background-color: #333; color: #ddd; }
+                a { color: #ddd; }
+                a:visited { color: #bbb; }
+            }
+        </style>
+    </head>
+    <body>
+        Nothing to see here. Please <a href="https://pkg.go.dev/go.uber.org/zap/exp">move along</a>.
+    </body>
+</html>
+`)
+}
+
+func TestMovedPackage(t *testing.T) {
+	movedConfig := `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+  oldzap:
+    repo: github.com/uber-go/zap
+    moved_to: go.uber.org/zap
+`
+	templates := getTestTemplates(t, nil)
+
+	tests := []struct {
+		desc string
+		path string
+		want string // Location header
+	}{
+		{desc: "package", path: "/oldzap", want: "https://go.uber.org/zap"},
+		{desc: "trailing slash", path: "/oldzap/", want: "https://go.uber.org/zap/"},
+		{desc: "subpackage", path: "/oldzap/zapcore", want: "https://go.uber.org/zap/zapcore"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			rr := CallAndRecord(t, movedConfig, templates, tt.path)
+			assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+			assert.Equal(t, tt.want, rr.Header().Get("Location"))
+		})
+	}
+
+	t.Run("go get", func(t *testing.T) {
+		rr := CallAndRecord(t, movedConfig, templates, "/oldzap/zapcore?go-get=1")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(),
+			`<meta name="go-import" content="go.uber.org/oldzap git https://github.com/uber-go/zap">`)
+	})
+
+	t.Run("index", func(t *testing.T) {
+		rr := CallAndRecord(t, movedConfig, templates, "/")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(),
+			`Moved to <a href="https://go.uber.org/zap">go.uber.org/zap</a>`)
+	})
+}
+
+func TestPackageStatus(t *testing.T) {
+	statusConfig := `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+  multierr:
+    repo: github.com/uber-go/multierr
+    status: deprecated
+    replacement: errors
+  tchannel:
+    repo: github.com/uber/tchannel-go
+    status: archived
+    status_message: TChannel is no longer developed.
+`
+	templates := getTestTemplates(t, nil)
+
+	t.Run("package", func(t *testing.T) {
+		rr := CallAndRecord(t, statusConfig, templates, "/multierr")
+		AssertResponse(t, rr, 200, `
+<!DOCTYPE html>
+<html>
+    <head>
+        <meta name="go-import" content="go.uber.org/multierr git https://github.com/uber-go/multierr">
+        <meta http-equiv="refresh" content="10; url=https://pkg.go.dev/go.uber.org/multierr">
+        <style>
+            @media (prefers-color-scheme: dark) {
+                body { background-color: #333; color: #ddd; }
+                a { color: #ddd; }
+                a:visited { color: #bbb; }
+            }
+        </style>
+    </head>
+    <body>
+        <p class="status">
+            <strong>Deprecated:</strong>
+            go.uber.org/multierr is no longer maintained.
+            Use errors instead.
+        </p>
+        Nothing to see here. Please <a href="https://pkg.go.dev/go.uber.org/multierr">move along</a>.
+    </body>
+</html>
+`)
+	})
+
+	t.Run("archived package", func(t *testing.T) {
+		rr := CallAndRecord(t, statusConfig, templates, "/tchannel")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		body := rr.Body.String()
+		assert.Contains(t, body, "<strong>Archived:</strong>")
+		assert.Contains(t, body, "TChannel is no longer developed.")
+	})
+
+	t.Run("index", func(t *testing.T) {
+		rr := CallAndRecord(t, statusConfig, templates, "/")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		body := rr.Body.String()
+		assert.Contains(t, body, `<span class="status status-deprecated">deprecated</span>`)
+		assert.Contains(t, body, "Use errors instead")
+		assert.NotContains(t, body, `href="https://errors"`)
+		assert.Contains(t, body, "<summary>Archived packages (1)</summary>")
+
+		// Archived packages are listed only inside the collapsed section.
+		archived := body[strings.Index(body, "<details"):]
+		assert.Equal(t, 1, strings.Count(body, "github.com/uber/tchannel-go</a>"))
+		assert.Contains(t, archived, "github.com/uber/tchannel-go</a>")
+		assert.NotContains(t, archived, "github.com/uber-go/zap</a>")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		rr := CallAndRecord(t, statusConfig, templates, "/api/packages")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Packages []struct {
+				Name          string `json:"name"`
+				Status        string `json:"status"`
+				StatusMessage string `json:"status_message"`
+				Replacement   string `json:"replacement"`
+			} `json:"packages"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+		require.Len(t, res.Packages, 3)
+		assert.Equal(t, "multierr", res.Packages[0].Name)
+		assert.Equal(t, "deprecated", res.Packages[0].Status)
+		assert.Equal(t, "errors", res.Packages[0].Replacement)
+		assert.Equal(t, "archived", res.Packages[1].Status)
+		assert.Equal(t, "TChannel is no longer developed.", res.Packages[1].StatusMessage)
+		assert.Empty(t, res.Packages[2].Status)
+	})
+}
+
+func TestModuleProxy(t *testing.T) {
+	templates := getTestTemplates(t, nil)
+
+	t.Run("proxy only", func(t *testing.T) {
+		rr := CallAndRecord(t, `
+url: go.uber.org
+packages:
+  zap:
+    repo: proxy.example.com
+    vcs: mod
+`, templates, "/zap?go-get=1")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		body := rr.Body.String()
+		assert.Contains(t, body, `<meta name="go-import" content="go.uber.org/zap mod https://proxy.example.com">`)
+		assert.Equal(t, 1, strings.Count(body, "go-import"))
+	})
+
+	t.Run("with origin", func(t *testing.T) {
+		cfg := `
+url: go.uber.org
+packages:
+  zap:
+    repo: proxy.example.com
+    vcs: mod
+    subdir: zap
+    origin:
+      repo: hg.example.com/uber
+      vcs: hg
+`
+		rr := CallAndRecord(t, cfg, templates, "/zap?go-get=1")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		body := rr.Body.String()
+		assert.Contains(t, body, `<meta name="go-import" content="go.uber.org/zap mod https://proxy.example.com">`)
+		assert.Contains(t, body, `<meta name="go-import" content="go.uber.org/zap hg https://hg.example.com/uber zap">`)
+
+		rr = CallAndRecord(t, cfg, templates, "/")
+		assert.Contains(t, rr.Body.String(), `<a href="https://hg.example.com/uber">hg.example.com/uber</a>`)
+	})
+}
+
+func TestRepoScheme(t *testing.T) {
+	cfg := `
+url: go.uber.org
+packages:
+  zap:
+    repo: ssh://git@git.example.com/uber-go/zap.git
+  yarpc:
+    repo: http://git.internal/yarpc
+`
+	templates := getTestTemplates(t, nil)
+
+	rr := CallAndRecord(t, cfg, templates, "/zap?go-get=1")
+	assert.Contains(t, rr.Body.String(),
+		`<meta name="go-import" content="go.uber.org/zap git ssh://git@git.example.com/uber-go/zap.git">`)
+
+	rr = CallAndRecord(t, cfg, templates, "/yarpc?go-get=1")
+	assert.Contains(t, rr.Body.String(),
+		`<meta name="go-import" content="go.uber.org/yarpc git http://git.internal/yarpc">`)
+
+	rr = CallAndRecord(t, cfg, templates, "/")
+	body := rr.Body.String()
+	assert.Contains(t, body,
+		`<a href="https://git.example.com/uber-go/zap">ssh://git@git.example.com/uber-go/zap.git</a>`)
+	assert.Contains(t, body, `<a href="http://git.internal/yarpc">http://git.internal/yarpc</a>`)
+}
+
+func TestPackageLinks(t *testing.T) {
+	cfg := `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+    homepage: https://zap.example.com
+  yarpc:
+    repo: ssh://review.example.com:29418/yarpc
+    browse_url: https://review.example.com/plugins/gitiles/yarpc
+    issues_url: https://bugs.example.com/yarpc
+  multierr:
+    repo: git.example.com/multierr.git
+`
+
+	rr := CallAndRecord(t, cfg, getTestTemplates(t, nil), "/api/packages")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var res apiResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+	links := make(map[string][3]string)
+	for _, pkg := range res.Packages {
+		links[pkg.Name] = [3]string{pkg.BrowseURL, pkg.Homepage, pkg.IssuesURL}
+	}
+	assert.Equal(t, map[string][3]string{
+		"zap": {
+			"https://github.com/uber-go/zap",
+			"https://zap.example.com",
+			"https://github.com/uber-go/zap/issues",
+		},
+		"yarpc": {
+			"https://review.example.com/plugins/gitiles/yarpc",
+			"",
+			"https://bugs.example.com/yarpc",
+		},
+		"multierr": {"https://git.example.com/multierr.git", "", ""},
+	}, links)
+
+	rr = CallAndRecord(t, cfg, getTestTemplates(t, nil), "/")
+	body := rr.Body.String()
+	assert.Contains(t, body, `<a href="https://zap.example.com">Homepage</a>`)
+	assert.Contains(t, body, `<a href="https://bugs.example.com/yarpc">Issues</a>`)
+	assert.Contains(t, body,
+		`<a href="https://review.example.com/plugins/gitiles/yarpc">ssh://review.example.com:29418/yarpc</a>`)
+}
+
+func TestBrowserRedirect(t *testing.T) {
+	cfg := `
+url: go.uber.org
+browser_redirect: repo
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+  yarpc:
+    repo: github.com/yarpc/yarpc-go
+    browser_redirect: docs
+  fx:
+    repo: github.com/uber-go/fx
+    browser_redirect: https://uber-go.github.io/fx/
+  atomic:
+    repo: github.com/uber-go/atomic
+    browser_redirect: none
+`
+	templates := getTestTemplates(t, nil)
+
+	tests := []struct {
+		desc string
+		path string
+		want string // refresh URL, or empty for none
+	}{
+		{desc: "global", path: "/zap/zapcore", want: "https://github.com/uber-go/zap"},
+		{desc: "docs", path: "/yarpc/encoding", want: "https://pkg.go.dev/go.uber.org/yarpc/encoding"},
+		{desc: "custom", path: "/fx", want: "https://uber-go.github.io/fx/"},
+		{desc: "none", path: "/atomic"},
+		{desc: "go get", path: "/zap?go-get=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			rr := CallAndRecord(t, cfg, templates, tt.path)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			body := rr.Body.String()
+			assert.Contains(t, body, `<meta name="go-import"`)
+			if tt.want == "" {
+				assert.NotContains(t, body, `http-equiv="refresh"`)
+			} else {
+				assert.Contains(t, body, `<meta http-equiv="refresh" content="0; url=`+tt.want+`">`)
+			}
+		})
+	}
+
+	t.Run("go get body", func(t *testing.T) {
+		rr := CallAndRecord(t, cfg, templates, "/atomic?go-get=1")
+		AssertResponse(t, rr, 200, `
+<!DOCTYPE html>
+<html>
+    <head>
+        <meta name="go-import" content="go.uber.org/atomic git https://github.com/uber-go/atomic">
+        <style>
+            @media (prefers-color-scheme: dark) {
+                body { background-color: #333; color: #ddd; }
+                a { color: #ddd; }
+                a:visited { color: #bbb; }
+            }
+        </style>
+    </head>
+    <body>
+        go.uber.org/atomic:
+        <a href="https://pkg.go.dev/go.uber.org/atomic">documentation</a>,
+        <a href="https://github.com/uber-go/atomic">source</a>.
+    </body>
+</html>
+`)
+	})
+}
+
+func TestPackageDetail(t *testing.T) {
+	cfg := `
+url: go.uber.org
+browser_redirect: none
+packages:
+  net/metrics:
+    repo: github.com/yarpc/metrics
+    description: Metrics for YARPC.
+  net/something:
+    repo: github.com/yarpc/something
+    description: Something else.
+    homepage: https://something.example.com
+  net/old:
+    repo: github.com/yarpc/old
+    status: archived
+  zap:
+    repo: github.com/uber-go/zap
+    status: deprecated
+    replacement: go.uber.org/zap/v2
+`
+	templates := getTestTemplates(t, nil)
+
+	t.Run("module", func(t *testing.T) {
+		rr := CallAndRecord(t, cfg, templates, "/net/metrics")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		body := rr.Body.String()
+		assert.Contains(t, body, `<meta name="go-import" content="go.uber.org/net/metrics git https://github.com/yarpc/metrics">`)
+		assert.Contains(t, body, `<h4>go.uber.org/net/metrics</h4>`)
+		assert.Contains(t, body, `<p class="description">Metrics for YARPC.</p>`)
+		assert.Contains(t, body, `<code id="install">go get go.uber.org/net/metrics@latest</code>`)
+		assert.Contains(t, body, `<a href="https://pkg.go.dev/go.uber.org/net/metrics">Documentation</a>`)
+		assert.Contains(t, body, `<a href="https://github.com/yarpc/metrics/issues">Issues</a>`)
+		assert.NotContains(t, body, "Homepage")
+		assert.NotContains(t, body, "Package <code>")
+
+		assert.Contains(t, body, "Related packages")
+		assert.Contains(t, body, `<a href="/net/something">go.uber.org/net/something</a>`)
+		assert.NotContains(t, body, `<a href="/net/metrics">`, "must not list itself")
+		assert.NotContains(t, body, `<a href="/net/old">`, "must not list archived packages")
+	})
+
+	t.Run("subpackage", func(t *testing.T) {
+		rr := CallAndRecord(t, cfg, templates, "/net/something/internal/x")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		body := rr.Body.String()
+		assert.Contains(t, body, `<title>go.uber.org/net/something/internal/x</title>`)
+		assert.Contains(t, body, `<p>Package <code>go.uber.org/net/something/internal/x</code></p>`)
+		assert.Contains(t, body, `<code id="install">go get go.uber.org/net/something/internal/x@latest</code>`)
+		assert.Contains(t, body, `<a href="https://pkg.go.dev/go.uber.org/net/something/internal/x">Documentation</a>`)
+		assert.Contains(t, body, `<a href="https://something.example.com">Homepage</a>`)
+	})
+
+	t.Run("top level", func(t *testing.T) {
+		rr := CallAndRecord(t, cfg, templates, "/zap")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		body := rr.Body.String()
+		assert.Contains(t, body, "<strong>Deprecated:</strong>")
+		assert.Contains(t, body, `Use <a href="https://go.uber.org/zap/v2">go.uber.org/zap/v2</a> instead.`)
+		assert.NotContains(t, body, "Related packages")
+	})
+
+	t.Run("go get", func(t *testing.T) {
+		rr := CallAndRecord(t, cfg, templates, "/net/metrics?go-get=1")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		body := rr.Body.String()
+		assert.Contains(t, body, `<meta name="go-import" content="go.uber.org/net/metrics git https://github.com/yarpc/metrics">`)
+		assert.NotContains(t, body, "go get")
+		assert.NotContains(t, body, "Related packages")
+	})
+}
+
 func TestPostRejected(t *testing.T) {
 	t.Parallel()
 
@@ -252,24 +678,112 @@ func TestPostRejected(t *testing.T) {
 		{desc: "index", path: "/"},
 		{desc: "package", path: "/zap"},
 		{desc: "subpackage", path: "/zap/zapcore"},
+		{desc: "api", path: "/api/packages"},
+		{desc: "not found", path: "/nope"},
 	}
 
+	for _, tt := range tests {
+		tt := tt
+		for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch} {
+			method := method
+			t.Run(tt.desc+"/"+method, func(t *testing.T) {
+				t.Parallel()
+
+				req, err := http.NewRequest(method, srv.URL+tt.path, strings.NewReader("foo"))
+				require.NoError(t, err)
+				res, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				defer func() {
+					assert.NoError(t, res.Body.Close())
+				}()
+
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+
+				assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode,
+					"expected 405, got:\n%s", string(body))
+				assert.Equal(t, "GET, HEAD, OPTIONS", res.Header.Get("Allow"))
+			})
+		}
+	}
+}
+
+func TestHeadRequests(t *testing.T) {
+	t.Parallel()
+
+	h, err := CreateHandler(&Config{
+		URL: "go.uberalt.org",
+		Packages: map[string]PackageConfig{
+			"zap": {
+				Repo: "github.com/uber-go/zap",
+			},
+			"net/metrics": {
+				Repo: "github.com/yarpc/metrics",
+			},
+		},
+	}, getTestTemplates(t, nil))
+	require.NoError(t, err)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		desc     string
+		path     string
+		wantCode int
+	}{
+		{desc: "index", path: "/", wantCode: http.StatusOK},
+		{desc: "subindex", path: "/net", wantCode: http.StatusOK},
+		{desc: "package", path: "/zap", wantCode: http.StatusOK},
+		{desc: "go get", path: "/zap?go-get=1", wantCode: http.StatusOK},
+		{desc: "subpackage", path: "/zap/zapcore", wantCode: http.StatusOK},
+		{desc: "api", path: "/api/packages", wantCode: http.StatusOK},
+		{desc: "not found", path: "/nope", wantCode: http.StatusNotFound},
+	}
+
+	// Compare the same representation of each resource.
+	// The client asks for gzip only on GET requests by default.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	t.Cleanup(client.CloseIdleConnections)
+
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.desc, func(t *testing.T) {
 			t.Parallel()
 
-			res, err := http.Post(srv.URL+tt.path, "text/plain", strings.NewReader("foo"))
+			get, err := client.Get(srv.URL + tt.path)
 			require.NoError(t, err)
-			defer func() {
-				assert.NoError(t, res.Body.Close())
-			}()
+			getBody, err := io.ReadAll(get.Body)
+			require.NoError(t, err)
+			require.NoError(t, get.Body.Close())
+			require.NotEmpty(t, getBody)
 
-			body, err := io.ReadAll(res.Body)
+			head, err := client.Head(srv.URL + tt.path)
+			require.NoError(t, err)
+			headBody, err := io.ReadAll(head.Body)
 			require.NoError(t, err)
+			require.NoError(t, head.Body.Close())
+
+			assert.Equal(t, tt.wantCode, head.StatusCode)
+			assert.Equal(t, get.StatusCode, head.StatusCode)
+			assert.Empty(t, headBody)
+			for _, key := range []string{"Content-Type", "Content-Length", "Content-Encoding", "ETag", "Last-Modified", "Cache-Control", "Vary"} {
+				assert.Equal(t, get.Header.Get(key), head.Header.Get(key), "header %v", key)
+			}
+		})
+	}
+}
+
+func TestOptionsRequests(t *testing.T) {
+	t.Parallel()
 
-			assert.Equal(t, http.StatusNotFound, res.StatusCode,
-				"expected 404, got:\n%s", string(body))
+	h := CreateHandlerFromYAML(t, getTestTemplates(t, nil), config)
+	for _, path := range []string{"/", "/zap", "/zap/zapcore", "/api/packages"} {
+		t.Run(path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodOptions, path, nil))
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+			assert.Equal(t, "GET, HEAD, OPTIONS", rr.Header().Get("Allow"))
+			assert.Empty(t, rr.Body.String())
 		})
 	}
 }
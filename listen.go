@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// Prefixes of listener addresses that don't use TCP.
+const (
+	_unixPrefix    = "unix:"
+	_systemdPrefix = "systemd:"
+)
+
+// listen opens a listener for the given configuration.
+func listen(cfg ListenerConfig) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(cfg.Addr, _unixPrefix):
+		return listenUnix(strings.TrimPrefix(cfg.Addr, _unixPrefix), cfg.Mode, cfg.Owner)
+	case strings.HasPrefix(cfg.Addr, _systemdPrefix):
+		return systemdListener(strings.TrimPrefix(cfg.Addr, _systemdPrefix), os.Getenv, os.Getpid())
+	default:
+		return net.Listen("tcp", cfg.Addr)
+	}
+}
+
+// listenUnix listens on a Unix domain socket at path,
+// replacing a stale socket left behind by a previous process.
+// If provided, mode is the octal file mode of the socket,
+// and owner is the user and optional group owning it, as "user[:group]".
+func listenUnix(path, mode, owner string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%v exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setSocketPermissions(path, mode, owner); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func setSocketPermissions(path, mode, owner string) error {
+	if mode != "" {
+		perm, err := parseFileMode(mode)
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(path, perm); err != nil {
+			return err
+		}
+	}
+
+	if owner != "" {
+		uid, gid, err := lookupOwner(owner)
+		if err != nil {
+			return err
+		}
+		if err := os.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseFileMode parses an octal file mode like "0660".
+func parseFileMode(s string) (fs.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > uint64(fs.ModePerm) {
+		return 0, fmt.Errorf("invalid file mode %q: must be octal permissions like 0660", s)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// lookupOwner resolves "user[:group]" to numeric user and group IDs.
+// Names and numeric IDs are both accepted.
+// The group ID is -1, leaving the group unchanged, if no group is given.
+func lookupOwner(owner string) (uid, gid int, err error) {
+	userName, groupName, hasGroup := strings.Cut(owner, ":")
+
+	u, err := user.Lookup(userName)
+	if err != nil {
+		if u, err = user.LookupId(userName); err != nil {
+			return 0, 0, fmt.Errorf("unknown user %q", userName)
+		}
+	}
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return 0, 0, fmt.Errorf("user %q has non-numeric ID %q", userName, u.Uid)
+	}
+
+	gid = -1
+	if hasGroup {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return 0, 0, fmt.Errorf("unknown group %q", groupName)
+			}
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, fmt.Errorf("group %q has non-numeric ID %q", groupName, g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
+// _systemdFirstFD is the first file descriptor passed by systemd
+// socket activation. See sd_listen_fds(3).
+const _systemdFirstFD = 3
+
+// systemdListener returns a listener passed to this process
+// by systemd socket activation.
+//
+// name selects the socket by its FileDescriptorName= in the socket unit,
+// or by its zero-based index if it's a number.
+func systemdListener(name string, getenv func(string) string, pid int) (net.Listener, error) {
+	return systemdListenerFrom(_systemdFirstFD, name, getenv, pid)
+}
+
+func systemdListenerFrom(firstFD int, name string, getenv func(string) string, pid int) (net.Listener, error) {
+	if getenv("LISTEN_PID") != strconv.Itoa(pid) {
+		return nil, errors.New("no sockets passed by systemd: LISTEN_PID does not match this process")
+	}
+
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, errors.New("no sockets passed by systemd: LISTEN_FDS is not set")
+	}
+
+	var names []string
+	if s := getenv("LISTEN_FDNAMES"); s != "" {
+		names = strings.Split(s, ":")
+	}
+
+	idx := -1
+	for i, n := range names {
+		if n == name {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		if i, err := strconv.Atoi(name); err == nil {
+			idx = i
+		}
+	}
+	if idx < 0 || idx >= count {
+		return nil, fmt.Errorf("no socket %q passed by systemd", name)
+	}
+
+	f := os.NewFile(uintptr(firstFD+idx), fmt.Sprintf("systemd:%v", name))
+	defer f.Close() // net.FileListener duplicates the descriptor
+
+	return net.FileListener(f)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenTCP(t *testing.T) {
+	ln, err := listen(ListenerConfig{Addr: "127.0.0.1:0"})
+	require.NoError(t, err)
+	defer ln.Close()
+
+	assert.Equal(t, "tcp", ln.Addr().Network())
+}
+
+func TestListenUnix(t *testing.T) {
+	// Unix socket paths are limited in length,
+	// so avoid the potentially long t.TempDir().
+	dir, err := os.MkdirTemp("", "sally")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "sally.sock")
+
+	ln, err := listen(ListenerConfig{Addr: "unix:" + path, Mode: "0600"})
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	t.Run("stale socket", func(t *testing.T) {
+		// Leave the socket file behind as a crashed process would.
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, ln.Close())
+
+		ln, err := listen(ListenerConfig{Addr: "unix:" + path})
+		require.NoError(t, err)
+		require.NoError(t, ln.Close())
+	})
+
+	t.Run("not a socket", func(t *testing.T) {
+		file := filepath.Join(dir, "regular")
+		require.NoError(t, os.WriteFile(file, nil, 0o644))
+
+		_, err := listen(ListenerConfig{Addr: "unix:" + file})
+		assert.ErrorContains(t, err, "not a socket")
+	})
+}
+
+func TestLookupOwner(t *testing.T) {
+	current, err := user.Current()
+	require.NoError(t, err)
+	wantUID, err := strconv.Atoi(current.Uid)
+	require.NoError(t, err)
+	wantGID, err := strconv.Atoi(current.Gid)
+	require.NoError(t, err)
+
+	uid, gid, err := lookupOwner(current.Username)
+	require.NoError(t, err)
+	assert.Equal(t, wantUID, uid)
+	assert.Equal(t, -1, gid)
+
+	uid, gid, err = lookupOwner(current.Uid + ":" + current.Gid)
+	require.NoError(t, err)
+	assert.Equal(t, wantUID, uid)
+	assert.Equal(t, wantGID, gid)
+
+	_, _, err = lookupOwner("sally-no-such-user")
+	assert.Error(t, err)
+}
+
+func TestSystemdListener(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcp.Close()
+
+	env := map[string]string{
+		"LISTEN_PID":     "42",
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "http",
+	}
+
+	tests := []struct {
+		desc    string
+		name    string
+		pid     int
+		env     map[string]string
+		wantErr string
+	}{
+		{desc: "by name", name: "http", pid: 42, env: env},
+		{desc: "by index", name: "0", pid: 42, env: env},
+		{desc: "unknown name", name: "admin", pid: 42, env: env, wantErr: `no socket "admin"`},
+		{desc: "index out of range", name: "1", pid: 42, env: env, wantErr: `no socket "1"`},
+		{desc: "other process", name: "http", pid: 43, env: env, wantErr: "LISTEN_PID"},
+		{
+			desc:    "no sockets",
+			name:    "http",
+			pid:     42,
+			env:     map[string]string{"LISTEN_PID": "42"},
+			wantErr: "LISTEN_FDS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			getenv := func(k string) string { return tt.env[k] }
+
+			// Simulate systemd passing the socket as the first descriptor.
+			// The listener takes ownership of the descriptor it's given,
+			// so hand it a fresh duplicate each time.
+			fd := dupListenerFD(t, tcp)
+
+			ln, err := systemdListenerFrom(fd, tt.name, getenv, tt.pid)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.NoError(t, syscall.Close(fd))
+				return
+			}
+			require.NoError(t, err)
+			defer ln.Close()
+			assert.Equal(t, tcp.Addr().String(), ln.Addr().String())
+		})
+	}
+}
+
+// dupListenerFD returns a new file descriptor for the given TCP listener,
+// not owned by any *os.File.
+func dupListenerFD(t *testing.T, ln net.Listener) int {
+	f, err := ln.(*net.TCPListener).File()
+	require.NoError(t, err)
+	defer f.Close()
+
+	fd, err := syscall.Dup(int(f.Fd()))
+	require.NoError(t, err)
+	return fd
+}
+
+func TestListenerValidation(t *testing.T) {
+	_, err := Parse(TempFile(t, `
+url: go.uber.org
+listeners:
+  - addr: 127.0.0.1:8080
+  - addr: localhost
+  - addr: unix:/run/sally.sock
+    mode: rw
+  - addr: :8080
+    owner: www-data
+  - addr: "systemd:"
+  - admin_only: true
+  - addr: :9090
+    admin_only: true
+    no_admin: true
+`))
+	require.Error(t, err)
+	assert.Equal(t, `5:5: listeners[1]: address localhost: missing port in address
+6:5: listeners[2]: invalid file mode "rw": must be octal permissions like 0660
+8:5: listeners[3]: mode and owner apply only to unix sockets
+10:5: listeners[4]: systemd socket name is required
+11:5: listeners[5]: addr is required
+12:5: listeners[6]: admin_only and no_admin are mutually exclusive`, err.Error())
+}
@@ -3,29 +3,45 @@
 package main // import "go.uber.org/sally"
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	yml := flag.String("yml", "sally.yaml", "yaml file to read config from")
 	tpls := flag.String("templates", "", "directory of .html templates to use")
-	port := flag.Int("port", 8080, "port to listen and serve on")
+	port := flag.Int("port", 8080, "port to listen and serve on if no listeners are configured")
+	var listenAddrs stringsFlag
+	flag.Var(&listenAddrs, "listen",
+		"address to serve on: host:port, unix:/path, or systemd:name; may be repeated.\n"+
+			"Overrides listeners in the yaml file.")
+	reloadInterval := flag.Duration("reload-interval", 5*time.Second,
+		"how often to check the yaml file for changes; 0 disables polling")
+	tlsCert := flag.String("tls-cert", "", "certificate file to serve HTTPS with; overrides tls.cert_file")
+	tlsKey := flag.String("tls-key", "", "private key file for -tls-cert; overrides tls.key_file")
+	debug := flag.Bool("debug", false, "show template errors in 500 responses; overrides debug")
 	flag.Parse()
 
-	log.Printf("Parsing yaml at path: %s\n", *yml)
-	config, err := Parse(*yml)
-	if err != nil {
-		log.Fatalf("Failed to parse %s: %v", *yml, err)
-	}
-
 	var templates *template.Template
 	if *tpls != "" {
 		log.Printf("Parsing templates at path: %s\n", *tpls)
+		var err error
 		templates, err = getCombinedTemplates(*tpls)
 		if err != nil {
 			log.Fatalf("Failed to parse templates at %s: %v", *tpls, err)
@@ -34,14 +50,131 @@ func main() {
 		templates = _templates
 	}
 
-	log.Printf("Creating HTTP handler with config: %v", config)
-	handler, err := CreateHandler(config, templates)
-	if err != nil {
-		log.Fatalf("Failed to create handler: %v", err)
+	log.Printf("Parsing yaml at path: %s\n", *yml)
+	reloader := newReloader(*yml, func(config *Config) (http.Handler, error) {
+		if *debug {
+			config.Debug = true
+		}
+
+		handler, err := CreateHandler(config, templates)
+		if err != nil {
+			return nil, err
+		}
+
+		if config.AccessLog.Enabled {
+			accessLog, err := newAccessLogger(config.AccessLog, os.Stderr)
+			if err != nil {
+				return nil, err
+			}
+			handler = accessLog.Middleware(handler)
+		}
+		return handler, nil
+	}, log.Default())
+	if err := reloader.Reload(); err != nil {
+		log.Fatalf("Failed to load %s: %v", *yml, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *reloadInterval > 0 {
+		go reloader.Watch(ctx, *reloadInterval)
 	}
 
-	log.Printf(`Starting HTTP handler on ":%d"`, *port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *port), handler))
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Printf("Received SIGHUP, reloading %s", *yml)
+			if err := reloader.Reload(); err != nil {
+				log.Printf("Failed to reload %s, keeping previous configuration: %v", *yml, err)
+			}
+		}
+	}()
+
+	metrics := newMetrics()
+
+	config := reloader.Current().Config
+	tlsConfig := overrideTLSFiles(config.TLS, *tlsCert, *tlsKey)
+
+	var serverTLS *tls.Config
+	if tlsConfig.CertFile != "" || tlsConfig.KeyFile != "" {
+		var err error
+		serverTLS, err = newTLSConfig(tlsConfig)
+		if err != nil {
+			log.Fatalf("Failed to configure TLS: %v", err)
+		}
+		log.Printf("Serving HTTPS with certificate %s", tlsConfig.CertFile)
+	}
+
+	listeners := config.Listeners
+	switch {
+	case len(listenAddrs) > 0:
+		listeners = make([]ListenerConfig, len(listenAddrs))
+		for i, addr := range listenAddrs {
+			listeners[i] = ListenerConfig{Addr: addr}
+			if err := validateListener(listeners[i]); err != nil {
+				log.Fatalf("Invalid -listen %q: %v", addr, err)
+			}
+		}
+	case len(listeners) == 0:
+		listeners = []ListenerConfig{{Addr: fmt.Sprintf(":%d", *port)}}
+	}
+
+	var (
+		servers   []boundServer
+		httpsPort string // port of the first TCP listener serving HTTPS
+	)
+	for _, lc := range listeners {
+		ln, err := listen(lc)
+		if err != nil {
+			log.Fatalf("Failed to listen on %q: %v", lc.Addr, err)
+		}
+
+		srv := newServer(config.Server, listenerHandler(lc, reloader, metrics))
+
+		scheme := "HTTP"
+		if serverTLS != nil && !lc.Plaintext {
+			srv.TLSConfig = serverTLS
+			scheme = "HTTPS"
+			if _, p, err := net.SplitHostPort(ln.Addr().String()); err == nil && httpsPort == "" {
+				httpsPort = p
+			}
+		}
+
+		log.Printf("Serving %v on %q (admin only: %v, no admin: %v)", scheme, lc.Addr, lc.AdminOnly, lc.NoAdmin)
+		servers = append(servers, boundServer{Server: srv, Listener: ln})
+	}
+
+	if serverTLS != nil && tlsConfig.RedirectAddr != "" {
+		ln, err := net.Listen("tcp", tlsConfig.RedirectAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen on %q: %v", tlsConfig.RedirectAddr, err)
+		}
+
+		log.Printf("Redirecting HTTP requests on %q to HTTPS", tlsConfig.RedirectAddr)
+		servers = append(servers, boundServer{
+			Server:   newServer(config.Server, redirectToHTTPS(httpsPort)),
+			Listener: ln,
+		})
+	}
+
+	if err := runServers(ctx, config.Server.ShutdownTimeout, servers...); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// stringsFlag is a flag.Value that collects the values
+// of a flag that may be repeated.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
 }
 
 func getCombinedTemplates(dir string) (*template.Template, error) {
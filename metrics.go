@@ -0,0 +1,82 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics records Prometheus metrics about requests served by sally.
+//
+// Requests are labelled by the matched package name rather than the raw
+// path so that the number of time series is bounded by the configuration.
+type metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+// _metricsLabels are the labels attached to all request metrics.
+var _metricsLabels = []string{"handler", "package", "status", "go_get"}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "sally",
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests served.",
+		}, _metricsLabels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "sally",
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests served.",
+			Buckets:   prometheus.DefBuckets,
+		}, _metricsLabels),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.latency,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler returns an http.Handler that serves the metrics
+// in the Prometheus exposition format.
+func (m *metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware wraps the given handler, recording metrics for every request.
+func (m *metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, info := withRequestInfo(r)
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		handler := info.Handler
+		if handler == "" {
+			handler = "none"
+		}
+		labels := prometheus.Labels{
+			"handler": handler,
+			// Label requests for packages resolved from patterns by the pattern
+			// to avoid a distinct label for every name that matches it.
+			"package": cmp.Or(info.Pattern, info.Package),
+			"status":  strconv.Itoa(rec.StatusCode()),
+			"go_get":  strconv.FormatBool(isGoGet(r)),
+		}
+		m.requests.With(labels).Inc()
+		m.latency.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
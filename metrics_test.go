@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	m := newMetrics()
+	handler := m.Middleware(CreateHandlerFromYAML(t, getTestTemplates(t, nil), config))
+
+	for _, path := range []string{
+		"/zap?go-get=1",
+		"/zap/zapcore?go-get=1",
+		"/zap",
+		"/net",
+		"/nonexistent",
+		"/api/packages",
+	} {
+		serve(handler, path)
+	}
+
+	rr := serve(m.Handler(), "/metrics")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		`sally_http_requests_total{go_get="true",handler="package",package="zap",status="200"} 2`,
+		`sally_http_requests_total{go_get="false",handler="package",package="zap",status="200"} 1`,
+		`sally_http_requests_total{go_get="false",handler="index",package="",status="200"} 1`,
+		`sally_http_requests_total{go_get="false",handler="index",package="",status="404"} 1`,
+		`sally_http_requests_total{go_get="false",handler="api",package="",status="200"} 1`,
+		`sally_http_request_duration_seconds_count{go_get="true",handler="package",package="zap",status="200"} 2`,
+	} {
+		assert.Contains(t, body, want)
+	}
+	assert.NotContains(t, body, "zapcore", "raw paths must not be used as labels")
+}
+
+func TestMetricsUnhandled(t *testing.T) {
+	m := newMetrics()
+	handler := m.Middleware(http.NotFoundHandler())
+	serve(handler, "/foo")
+
+	body := serve(m.Handler(), "/metrics").Body.String()
+	assert.Contains(t, body,
+		`sally_http_requests_total{go_get="false",handler="none",package="",status="404"} 1`)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// pageOptions holds the settings shared by the pages of a handler.
+type pageOptions struct {
+	// Cache-Control headers by kind of page.
+	cacheControl CacheControlConfig
+
+	// Version of the configuration that pages are rendered from.
+	// It's part of every ETag, so that caches revalidate
+	// everything when the configuration changes.
+	version string
+
+	// Time at which the configuration was loaded,
+	// served as the Last-Modified time of pages.
+	modTime time.Time
+
+	// Pages rendered on request, if they're cached.
+	cache *pageCache
+
+	// Template for pages that fail to render, if any.
+	errorTemplate *template.Template
+
+	// Whether to show the errors of pages that fail to render
+	// to clients. See Config.Debug.
+	debug bool
+}
+
+// page is a successful HTML response,
+// usually rendered ahead of time.
+type page struct {
+	body    []byte
+	modTime time.Time
+
+	// Strong entity tag derived from the body
+	// and the configuration version.
+	etag string
+
+	// Compressed copies of the body, if any.
+	// Always empty for pages smaller than _compressMinSize.
+	encoded []encodedBody
+}
+
+// encodedBody is a page body compressed with a content coding.
+type encodedBody struct {
+	encoding string
+	body     []byte
+	etag     string
+}
+
+// render executes the template with the given data
+// and returns the result as a page.
+func (o *pageOptions) render(template *template.Template, data interface{}) (*page, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := template.Execute(buf, data); err != nil {
+		return nil, err
+	}
+
+	// The buffer is reused, so the page needs its own copy.
+	body := bytes.Clone(buf.Bytes())
+	hash := sha256.New()
+	hash.Write([]byte(o.version))
+	hash.Write(body)
+	return &page{
+		body:    body,
+		modTime: o.modTime,
+		etag:    `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`,
+	}, nil
+}
+
+// prerender renders a page to be served for many requests,
+// compressing it ahead of time with every supported encoding.
+func (o *pageOptions) prerender(template *template.Template, data interface{}) (*page, error) {
+	p, err := o.render(template, data)
+	if err != nil {
+		return nil, err
+	}
+	p.compress(_encodings...)
+	return p, nil
+}
+
+// serveHTML renders the template with the given data
+// and writes it with the given status.
+// The template is rendered in full before anything is written,
+// so that a template error results in a 500 response
+// rather than a truncated page.
+func (o *pageOptions) serveHTML(w http.ResponseWriter, status int, template *template.Template, data interface{}) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := template.Execute(buf, data); err != nil {
+		o.serveError(w, template, err)
+		return
+	}
+
+	writeHTML(w, status, buf.Bytes())
+}
+
+// serveError logs that the given template failed to render
+// and responds with a 500 error.
+//
+// The response is rendered from the error template, if any,
+// or is plain text otherwise.
+// It includes the error only in debug mode,
+// as template errors can reveal internal details.
+func (o *pageOptions) serveError(w http.ResponseWriter, template *template.Template, err error) {
+	log.Printf("Failed to render template %s: %v", template.Name(), err)
+
+	var data struct{ Error string }
+	if o.debug {
+		data.Error = err.Error()
+	}
+
+	if o.errorTemplate != nil {
+		buf := getBuffer()
+		defer putBuffer(buf)
+		err := o.errorTemplate.Execute(buf, data)
+		if err == nil {
+			writeHTML(w, http.StatusInternalServerError, buf.Bytes())
+			return
+		}
+		log.Printf("Failed to render template %s: %v", o.errorTemplate.Name(), err)
+	}
+
+	msg := http.StatusText(http.StatusInternalServerError)
+	if data.Error != "" {
+		msg += ": " + data.Error
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+func writeHTML(w http.ResponseWriter, status int, body []byte) {
+	if status >= 400 {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// _bufferPool holds buffers that templates are rendered into.
+var _bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// _maxPooledBufferSize is the capacity in bytes above which buffers
+// are dropped rather than returned to _bufferPool,
+// so that a rare large page doesn't pin its memory.
+const _maxPooledBufferSize = 1 << 20
+
+func getBuffer() *bytes.Buffer {
+	return _bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > _maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	_bufferPool.Put(buf)
+}
+
+// _compressMinSize is the size in bytes below which pages are sent
+// uncompressed. Compressing them saves little.
+const _compressMinSize = 1024
+
+// contentEncoding is a content coding that pages may be compressed with.
+type contentEncoding struct {
+	name     string
+	compress func([]byte) ([]byte, error)
+}
+
+// _encodings lists the supported content codings in order of preference.
+var _encodings = []contentEncoding{
+	{name: "zstd", compress: compressZstd},
+	{name: "gzip", compress: compressGzip},
+}
+
+// _zstdEncoder compresses pages with zstd.
+// Its EncodeAll method is safe for concurrent use.
+var _zstdEncoder = newZstdEncoder()
+
+// newZstdEncoder builds the encoder for _zstdEncoder.
+// It fails only with invalid options, so failure is a programming error.
+func newZstdEncoder() *zstd.Encoder {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(fmt.Sprintf("create zstd encoder: %v", err))
+	}
+	return enc
+}
+
+func compressZstd(b []byte) ([]byte, error) {
+	return _zstdEncoder.EncodeAll(b, nil), nil
+}
+
+// _gzipWriterPool holds gzip writers for compressGzip,
+// which are costly to allocate.
+var _gzipWriterPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+func compressGzip(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := _gzipWriterPool.Get().(*gzip.Writer)
+	defer func() {
+		// Don't hold on to the output while the writer is pooled.
+		zw.Reset(nil)
+		_gzipWriterPool.Put(zw)
+	}()
+	zw.Reset(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compress adds copies of the body compressed with the given encodings
+// if the page is large enough to benefit.
+// Compression is best-effort: encodings that fail or don't shrink the body
+// are skipped, and the page is served uncompressed to clients that want them.
+func (p *page) compress(encodings ...contentEncoding) {
+	if len(p.body) < _compressMinSize {
+		return
+	}
+
+	for _, enc := range encodings {
+		body, err := enc.compress(p.body)
+		if err != nil || len(body) >= len(p.body) {
+			continue
+		}
+
+		// Each encoding is a distinct representation with its own ETag.
+		p.encoded = append(p.encoded, encodedBody{
+			encoding: enc.name,
+			body:     body,
+			etag:     strings.TrimSuffix(p.etag, `"`) + "-" + enc.name + `"`,
+		})
+	}
+}
+
+// serve writes the page with the given Cache-Control header, if any.
+// Conditional requests for a page that the client already has
+// get a 304 Not Modified response.
+func (p *page) serve(w http.ResponseWriter, r *http.Request, cacheControl string) {
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	if cacheControl != "" {
+		h.Set("Cache-Control", cacheControl)
+	}
+
+	body, etag := p.body, p.etag
+	if len(p.body) >= _compressMinSize {
+		h.Add("Vary", "Accept-Encoding")
+		if enc := p.encodedAs(negotiateEncoding(r)); enc != nil {
+			body, etag = enc.body, enc.etag
+			h.Set("Content-Encoding", enc.encoding)
+		}
+	}
+
+	h.Set("ETag", etag)
+	http.ServeContent(w, r, "", p.modTime, bytes.NewReader(body))
+}
+
+// encodedAs returns the body compressed with the given encoding,
+// or nil if there is none.
+func (p *page) encodedAs(enc *contentEncoding) *encodedBody {
+	if enc == nil {
+		return nil
+	}
+	for i := range p.encoded {
+		if p.encoded[i].encoding == enc.name {
+			return &p.encoded[i]
+		}
+	}
+	return nil
+}
+
+// negotiateEncoding picks the content coding to compress the response with
+// based on the request's Accept-Encoding header,
+// or returns nil to send the response uncompressed.
+// Ties between encodings are broken by the order of _encodings.
+func negotiateEncoding(r *http.Request) *contentEncoding {
+	accepted := make(map[string]float64)
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			q := 1.0
+			if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				var err error
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					continue
+				}
+			}
+			accepted[strings.ToLower(strings.TrimSpace(name))] = q
+		}
+	}
+
+	var (
+		best  *contentEncoding
+		bestQ float64
+	)
+	for i, enc := range _encodings {
+		q, ok := accepted[enc.name]
+		if !ok {
+			q = accepted["*"]
+		}
+		if q > bestQ {
+			best, bestQ = &_encodings[i], q
+		}
+	}
+	return best
+}
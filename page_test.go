@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageHeaders(t *testing.T) {
+	templates := getTestTemplates(t, nil)
+	handler := CreateHandlerFromYAML(t, templates, config)
+
+	serve := func(t *testing.T, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr
+	}
+
+	tests := []struct {
+		desc string
+		path string
+	}{
+		{desc: "index", path: "/"},
+		{desc: "subindex", path: "/net"},
+		{desc: "subindex slash", path: "/net/"},
+		{desc: "package", path: "/zap"},
+		{desc: "go get", path: "/zap?go-get=1"},
+		{desc: "subpackage", path: "/zap/zapcore"},
+		{desc: "package slash", path: "/zap/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			rr := serve(t, tt.path)
+			etag := rr.Header().Get("ETag")
+			assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+			assert.Equal(t, fmt.Sprint(rr.Body.Len()), rr.Header().Get("Content-Length"))
+			assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+			assert.NotEmpty(t, rr.Header().Get("Last-Modified"))
+			assert.Empty(t, rr.Header().Get("Cache-Control"))
+			assert.Equal(t, etag, serve(t, tt.path).Header().Get("ETag"), "ETag must be stable")
+		})
+	}
+
+	t.Run("distinct", func(t *testing.T) {
+		etags := make(map[string]string)
+		for _, path := range []string{"/", "/net", "/zap", "/zap?go-get=1", "/zap/zapcore", "/yarpc"} {
+			etag := serve(t, path).Header().Get("ETag")
+			if other, ok := etags[etag]; ok {
+				t.Errorf("%v and %v have the same ETag %v", path, other, etag)
+			}
+			etags[etag] = path
+		}
+	})
+}
+
+func TestConditionalRequests(t *testing.T) {
+	handler := CreateHandlerFromYAML(t, getTestTemplates(t, nil), config)
+
+	for _, path := range []string{"/", "/net", "/zap", "/zap?go-get=1", "/zap/zapcore"} {
+		t.Run(path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+			require.Equal(t, http.StatusOK, rr.Code)
+			etag := rr.Header().Get("ETag")
+			lastModified := rr.Header().Get("Last-Modified")
+
+			tests := []struct {
+				desc     string
+				header   string
+				value    string
+				wantCode int
+			}{
+				{desc: "matching etag", header: "If-None-Match", value: etag, wantCode: http.StatusNotModified},
+				{desc: "one of etags", header: "If-None-Match", value: `"other", ` + etag, wantCode: http.StatusNotModified},
+				{desc: "any etag", header: "If-None-Match", value: "*", wantCode: http.StatusNotModified},
+				{desc: "other etag", header: "If-None-Match", value: `"other"`, wantCode: http.StatusOK},
+				{desc: "not modified since", header: "If-Modified-Since", value: lastModified, wantCode: http.StatusNotModified},
+				{
+					desc:     "modified since",
+					header:   "If-Modified-Since",
+					value:    "Mon, 02 Jan 2006 15:04:05 GMT",
+					wantCode: http.StatusOK,
+				},
+			}
+			for _, tt := range tests {
+				t.Run(tt.desc, func(t *testing.T) {
+					req := httptest.NewRequest("GET", path, nil)
+					req.Header.Set(tt.header, tt.value)
+					rr := httptest.NewRecorder()
+					handler.ServeHTTP(rr, req)
+
+					assert.Equal(t, tt.wantCode, rr.Code)
+					assert.Equal(t, etag, rr.Header().Get("ETag"))
+					if tt.wantCode == http.StatusNotModified {
+						assert.Empty(t, rr.Body.String())
+					} else {
+						assert.NotEmpty(t, rr.Body.String())
+					}
+				})
+			}
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/nope", nil)
+		req.Header.Set("If-None-Match", "*")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestCacheControl(t *testing.T) {
+	handler := CreateHandlerFromYAML(t, getTestTemplates(t, nil), `
+url: go.uber.org
+cache_control:
+  index: public, max-age=60
+  package: public, max-age=300
+  go_get: public, max-age=3600
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+  net/metrics:
+    repo: github.com/yarpc/metrics
+  "*":
+    repo: github.com/uber-go/{name}
+`)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/", want: "public, max-age=60"},
+		{path: "/net", want: "public, max-age=60"},
+		{path: "/zap", want: "public, max-age=300"},
+		{path: "/zap/zapcore", want: "public, max-age=300"},
+		{path: "/atomic", want: "public, max-age=300"},
+		{path: "/zap?go-get=1", want: "public, max-age=3600"},
+		{path: "/zap/zapcore?go-get=1", want: "public, max-age=3600"},
+		{path: "/atomic?go-get=1", want: "public, max-age=3600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			assert.Equal(t, tt.want, rr.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestETagConfigVersion(t *testing.T) {
+	templates := getTestTemplates(t, nil)
+	etag := func(config string) string {
+		rr := CallAndRecord(t, config, templates, "/zap")
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr.Header().Get("ETag")
+	}
+
+	cfg := `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+`
+	assert.Equal(t, etag(cfg), etag(cfg))
+	assert.NotEqual(t, etag(cfg), etag(cfg+`
+  yarpc:
+    repo: github.com/yarpc/yarpc-go
+`), "ETag must change with the configuration")
+}
+
+func TestCompression(t *testing.T) {
+	handler := CreateHandlerFromYAML(t, getTestTemplates(t, nil), config)
+
+	get := func(t *testing.T, path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	identity := get(t, "/", "")
+	require.Equal(t, http.StatusOK, identity.Code)
+	require.GreaterOrEqual(t, identity.Body.Len(), _compressMinSize, "index must be large enough to compress")
+	assert.Empty(t, identity.Header().Get("Content-Encoding"))
+	assert.Contains(t, identity.Header().Values("Vary"), "Accept-Encoding")
+
+	tests := []struct {
+		acceptEncoding string
+		want           string // expected Content-Encoding
+	}{
+		{acceptEncoding: "gzip", want: "gzip"},
+		{acceptEncoding: "zstd", want: "zstd"},
+		{acceptEncoding: "gzip, deflate, br, zstd", want: "zstd"},
+		{acceptEncoding: "zstd;q=0.5, gzip", want: "gzip"},
+		{acceptEncoding: "GZIP", want: "gzip"},
+		{acceptEncoding: "*", want: "zstd"},
+		{acceptEncoding: "*, zstd;q=0", want: "gzip"},
+		{acceptEncoding: "gzip;q=0"},
+		{acceptEncoding: "br"},
+		{acceptEncoding: "identity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			rr := get(t, "/", tt.acceptEncoding)
+			require.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.want, rr.Header().Get("Content-Encoding"))
+			assert.Contains(t, rr.Header().Values("Vary"), "Accept-Encoding")
+
+			var body []byte
+			switch tt.want {
+			case "":
+				assert.Equal(t, identity.Header().Get("ETag"), rr.Header().Get("ETag"))
+				assert.Equal(t, fmt.Sprint(rr.Body.Len()), rr.Header().Get("Content-Length"))
+				body = rr.Body.Bytes()
+			case "gzip":
+				zr, err := gzip.NewReader(rr.Body)
+				require.NoError(t, err)
+				body, err = io.ReadAll(zr)
+				require.NoError(t, err)
+			case "zstd":
+				zr, err := zstd.NewReader(nil)
+				require.NoError(t, err)
+				defer zr.Close()
+				body, err = zr.DecodeAll(rr.Body.Bytes(), nil)
+				require.NoError(t, err)
+			}
+			assert.Equal(t, identity.Body.String(), string(body))
+
+			if tt.want != "" {
+				assert.Less(t, rr.Body.Len(), identity.Body.Len())
+				assert.NotEqual(t, identity.Header().Get("ETag"), rr.Header().Get("ETag"),
+					"compressed responses must have their own ETag")
+			}
+		})
+	}
+
+	t.Run("small page", func(t *testing.T) {
+		rr := get(t, "/zap?go-get=1", "gzip")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Less(t, rr.Body.Len(), _compressMinSize)
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Empty(t, rr.Header().Values("Vary"))
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		etag := get(t, "/net", "gzip").Header().Get("ETag")
+
+		req := httptest.NewRequest("GET", "/net", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("If-None-Match", etag)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Equal(t, etag, rr.Header().Get("ETag"))
+
+		// The uncompressed page is a different representation.
+		req.Header.Del("Accept-Encoding")
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestCompressGzipReuse(t *testing.T) {
+	// Pooled writers must not carry state between calls.
+	for _, want := range []string{strings.Repeat("a", 4096), "b", strings.Repeat("c", 100)} {
+		body, err := compressGzip([]byte(want))
+		require.NoError(t, err)
+
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		got, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(got))
+	}
+}
+
+func TestPrerenderedMatchesRendered(t *testing.T) {
+	templates := getTestTemplates(t, nil)
+	cfg, err := parseConfig([]byte(config))
+	require.NoError(t, err)
+
+	var pkgs []*sallyPackage
+	for name, pkgConfig := range cfg.Packages {
+		pkgs = append(pkgs, newSallyPackage(cfg, name, pkgConfig))
+	}
+	index := newIndexHandler(pkgs, templates.Lookup("index.html"), templates.Lookup("404.html"))
+	index.opts = new(pageOptions)
+
+	for _, path := range []string{"", "net"} {
+		rendered := httptest.NewRecorder()
+		start, end := index.rangeOf(path)
+		index.opts.serveHTML(rendered, http.StatusOK, index.indexTemplate, index.data(path, start, end))
+
+		require.NoError(t, index.prerender())
+		assert.Equal(t, rendered.Body.String(), string(index.pages[path].body), "index of %q", path)
+	}
+
+	for _, pkg := range pkgs {
+		h := &packageHandler{pkg: pkg, template: templates.Lookup("package.html"), index: index, opts: index.opts}
+		require.NoError(t, h.prerender())
+
+		for _, goGet := range []bool{true, false} {
+			rendered := httptest.NewRecorder()
+			h.opts.serveHTML(rendered, http.StatusOK, h.template, h.data("", goGet))
+
+			page := h.browserPage
+			if goGet {
+				page = h.goGetPage
+			}
+			assert.Equal(t, rendered.Body.String(), string(page.body), "package %q, go get %v", pkg.Name, goGet)
+		}
+	}
+}
+
+func TestPrerenderError(t *testing.T) {
+	tests := []struct {
+		desc      string
+		templates map[string]string
+		wantErr   string
+	}{
+		{
+			desc:      "package",
+			templates: map[string]string{"package.html": "{{ .Missing }}"},
+			wantErr:   `package "zap": `,
+		},
+		{
+			desc:      "index",
+			templates: map[string]string{"index.html": "{{ .Missing }}"},
+			wantErr:   `index of "": `,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := CreateHandler(&Config{
+				URL: "go.uber.org",
+				Packages: map[string]PackageConfig{
+					"zap": {Repo: "github.com/uber-go/zap"},
+				},
+			}, getTestTemplates(t, tt.templates))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+			assert.Contains(t, err.Error(), "Missing")
+		})
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	// package.html fails only for subpackages,
+	// which are rendered on request.
+	const failingPackage = "{{ if .Subpackage }}partial {{ .Missing }}{{ end }}ok"
+
+	tests := []struct {
+		desc      string
+		templates map[string]string
+		debug     bool
+		path      string
+
+		wantType   string
+		wantBody   string   // exact body, if set
+		wantSubstr []string // substrings of the body
+		wantLogs   []string // substrings of the log
+	}{
+		{
+			desc:       "default 500 page",
+			templates:  map[string]string{"package.html": failingPackage},
+			path:       "/zap/sub",
+			wantType:   "text/html; charset=utf-8",
+			wantSubstr: []string{"Something went wrong"},
+			wantLogs:   []string{"package.html", "Missing"},
+		},
+		{
+			desc:       "debug",
+			templates:  map[string]string{"package.html": failingPackage},
+			debug:      true,
+			path:       "/zap/sub",
+			wantType:   "text/html; charset=utf-8",
+			wantSubstr: []string{"Something went wrong", "Missing"},
+			wantLogs:   []string{"package.html", "Missing"},
+		},
+		{
+			desc: "custom 500 page",
+			templates: map[string]string{
+				"package.html": failingPackage,
+				"500.html":     "oops{{ with .Error }}: {{ . }}{{ end }}",
+			},
+			path:     "/zap/sub",
+			wantType: "text/html; charset=utf-8",
+			wantBody: "oops",
+			wantLogs: []string{"package.html"},
+		},
+		{
+			desc:      "not found page",
+			templates: map[string]string{"404.html": "{{ .Missing }}"},
+			path:      "/nope",
+			wantType:  "text/html; charset=utf-8",
+			wantLogs:  []string{"404.html", "Missing"},
+		},
+		{
+			desc: "failing 500 page",
+			templates: map[string]string{
+				"package.html": failingPackage,
+				"500.html":     "{{ .Missing }}",
+			},
+			path:     "/zap/sub",
+			wantType: "text/plain; charset=utf-8",
+			wantBody: "Internal Server Error\n",
+			wantLogs: []string{"package.html", "500.html"},
+		},
+		{
+			desc: "failing 500 page in debug",
+			templates: map[string]string{
+				"package.html": failingPackage,
+				"500.html":     "{{ .Missing }}",
+			},
+			debug:      true,
+			path:       "/zap/sub",
+			wantType:   "text/plain; charset=utf-8",
+			wantSubstr: []string{"Internal Server Error: ", "package.html", "Missing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			logs := captureLogs(t)
+			handler, err := CreateHandler(&Config{
+				URL: "go.uber.org",
+				Packages: map[string]PackageConfig{
+					"zap": {Repo: "github.com/uber-go/zap"},
+				},
+				Debug: tt.debug,
+			}, getTestTemplates(t, tt.templates))
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			assert.Equal(t, http.StatusInternalServerError, rr.Code)
+			assert.Equal(t, tt.wantType, rr.Header().Get("Content-Type"))
+			assert.Equal(t, "no-cache", rr.Header().Get("Cache-Control"))
+
+			body := rr.Body.String()
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, body)
+			}
+			for _, want := range tt.wantSubstr {
+				assert.Contains(t, body, want)
+			}
+			assert.NotContains(t, body, "partial", "must not serve part of the page")
+			if !tt.debug {
+				assert.NotContains(t, body, "Missing", "must not reveal the error")
+			}
+			for _, want := range tt.wantLogs {
+				assert.Contains(t, logs.String(), want)
+			}
+
+			// The package itself is pre-rendered and unaffected.
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", "/zap", nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+		})
+	}
+}
+
+// captureLogs redirects the standard logger
+// for the duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+// BenchmarkPrerendered compares serving pre-rendered pages
+// with rendering them on every request.
+func BenchmarkPrerendered(b *testing.B) {
+	for _, numPackages := range []int{100, 10000} {
+		b.Run(fmt.Sprintf("packages=%d", numPackages), func(b *testing.B) {
+			benchmarkPrerendered(b, numPackages)
+		})
+	}
+}
+
+func benchmarkPrerendered(b *testing.B, numPackages int) {
+	templates := getTestTemplates(b, nil)
+	cfg := &Config{URL: "go.uber.org", Godoc: GodocConfig{Host: "pkg.go.dev"}}
+
+	var pkgs []*sallyPackage
+	for i := 0; i < numPackages; i++ {
+		name := fmt.Sprintf("group%d/pkg%d", i%100, i)
+		pkgs = append(pkgs, newSallyPackage(cfg, name, PackageConfig{
+			Repo: "github.com/uber-go/" + strings.ReplaceAll(name, "/", "-"),
+			VCS:  "git",
+			Desc: "Package " + name + ".",
+		}))
+	}
+
+	// newRouter builds the router that CreateHandler would,
+	// with or without pre-rendered and cached pages.
+	newRouter := func(prerender bool) *packageRouter {
+		index := newIndexHandler(pkgs, templates.Lookup("index.html"), templates.Lookup("404.html"))
+		index.opts = new(pageOptions)
+		if prerender {
+			index.opts.cache = newPageCache(_pageCacheSize)
+			require.NoError(b, index.prerender())
+		}
+
+		router := &packageRouter{index: index, packages: make([]*packageHandler, len(index.pkgs))}
+		for i, pkg := range index.pkgs {
+			router.packages[i] = &packageHandler{pkg: pkg, template: templates.Lookup("package.html"), index: index, opts: index.opts}
+			if prerender {
+				require.NoError(b, router.packages[i].prerender())
+			}
+		}
+		return router
+	}
+
+	pkgName := "/" + pkgs[0].Name
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "index", path: "/"},
+		{name: "subindex", path: "/group0"},
+		{name: "package", path: pkgName},
+		{name: "go get", path: pkgName + "?go-get=1"},
+		// Subpackage pages are rendered on first request
+		// and cached rather than pre-rendered.
+		{name: "go get subpackage", path: pkgName + "/internal/x?go-get=1"},
+	}
+
+	for _, mode := range []struct {
+		name      string
+		prerender bool
+	}{
+		{name: "rendered", prerender: false},
+		{name: "prerendered", prerender: true},
+	} {
+		router := newRouter(mode.prerender)
+		for _, tt := range tests {
+			b.Run(tt.name+"/"+mode.name, func(b *testing.B) {
+				req := httptest.NewRequest("GET", tt.path, nil)
+				resw := new(nopResponseWriter)
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					router.ServeHTTP(resw, req)
+				}
+			})
+		}
+	}
+}
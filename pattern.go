@@ -0,0 +1,210 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// isPattern reports whether a key in the packages map
+// is a pattern rather than the name of a single package.
+//
+// Keys starting with '^' are regular expressions,
+// and keys containing '*' are globs.
+func isPattern(name string) bool {
+	return isRegexpPattern(name) || strings.Contains(name, "*")
+}
+
+func isRegexpPattern(name string) bool {
+	return strings.HasPrefix(name, "^")
+}
+
+// compilePattern compiles a pattern key into a regular expression
+// that matches complete package names.
+//
+// In globs, each '*' matches one or more characters other than '/'
+// and is captured as a numbered group.
+// Regular expressions are anchored at both ends.
+func compilePattern(key string) (*regexp.Regexp, error) {
+	if isRegexpPattern(key) {
+		// Compile the expression as written first
+		// so that errors refer to the user's input.
+		if _, err := regexp.Compile(key); err != nil {
+			return nil, err
+		}
+		return regexp.Compile("^(?:" + strings.TrimPrefix(key, "^") + ")$")
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i, literal := range strings.Split(key, "*") {
+		if i > 0 {
+			expr.WriteString("([^/]+)")
+		}
+		expr.WriteString(regexp.QuoteMeta(literal))
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// _placeholderRegexp matches placeholders like {name} or {1}
+// in the fields of pattern entries.
+var _placeholderRegexp = regexp.MustCompile(`\{(\w+)\}`)
+
+// checkPlaceholders reports an error for the first placeholder in s
+// that doesn't refer to the matched name or a group of re.
+func checkPlaceholders(re *regexp.Regexp, s string) error {
+	for _, m := range _placeholderRegexp.FindAllStringSubmatch(s, -1) {
+		if _, ok := placeholderIndex(re, m[1]); !ok {
+			return fmt.Errorf("unknown placeholder %v", m[0])
+		}
+	}
+	return nil
+}
+
+// withoutPlaceholders replaces placeholders in s with a sample value
+// so that it can be validated like a value without placeholders.
+func withoutPlaceholders(s string) string {
+	return _placeholderRegexp.ReplaceAllString(s, "x")
+}
+
+// placeholderIndex returns the index of the submatch
+// that the given placeholder refers to.
+// {name} refers to the entire match.
+func placeholderIndex(re *regexp.Regexp, placeholder string) (int, bool) {
+	if placeholder == "name" {
+		return 0, true
+	}
+	if i, err := strconv.Atoi(placeholder); err == nil {
+		return i, i >= 1 && i <= re.NumSubexp()
+	}
+	if i := re.SubexpIndex(placeholder); i >= 0 {
+		return i, true
+	}
+	return 0, false
+}
+
+// sallyPattern is a packages entry that serves every package
+// whose name matches a pattern.
+type sallyPattern struct {
+	// Pattern as written in the configuration.
+	Pattern string `json:"pattern"`
+
+	// Module path pattern, made of the base URL and the pattern.
+	ModulePath string `json:"module_path"`
+
+	// Description of matching packages, if any.
+	Desc string `json:"description,omitempty"`
+
+	// Version control system used by matching packages.
+	VCS string `json:"vcs"`
+
+	// Repository URL, before placeholders are replaced.
+	RepoURL string `json:"repo"`
+
+	// Directory inside the repository, before placeholders are replaced.
+	Subdir string `json:"subdir,omitempty"`
+
+	re     *regexp.Regexp
+	config *Config
+	pkg    PackageConfig
+}
+
+func newSallyPattern(config *Config, key string, pkg PackageConfig) (*sallyPattern, error) {
+	re, err := compilePattern(key)
+	if err != nil {
+		return nil, fmt.Errorf("package %q: %w", key, err)
+	}
+
+	return &sallyPattern{
+		Pattern:    key,
+		ModulePath: cmp.Or(pkg.URL, config.URL) + "/" + key,
+		Desc:       pkg.Desc,
+		VCS:        pkg.VCS,
+		RepoURL:    pkg.Repo,
+		Subdir:     pkg.Subdir,
+		re:         re,
+		config:     config,
+		pkg:        pkg,
+	}, nil
+}
+
+// resolve returns the package served for the given name,
+// or nil if the name doesn't match the pattern.
+func (p *sallyPattern) resolve(name string) *sallyPackage {
+	match := p.re.FindStringSubmatch(name)
+	if match == nil {
+		return nil
+	}
+
+	expand := func(s string) string {
+		return _placeholderRegexp.ReplaceAllStringFunc(s, func(placeholder string) string {
+			i, _ := placeholderIndex(p.re, strings.Trim(placeholder, "{}"))
+			return match[i]
+		})
+	}
+
+	pkg := newSallyPackage(p.config, name, PackageConfig{
+		Repo:   expand(p.pkg.Repo),
+		Subdir: expand(p.pkg.Subdir),
+		URL:    expand(p.pkg.URL),
+		VCS:    p.pkg.VCS,
+		Origin: OriginConfig{
+			Repo: expand(p.pkg.Origin.Repo),
+			VCS:  p.pkg.Origin.VCS,
+		},
+		Desc: expand(p.pkg.Desc),
+
+		BrowseURL: expand(p.pkg.BrowseURL),
+		Homepage:  expand(p.pkg.Homepage),
+		IssuesURL: expand(p.pkg.IssuesURL),
+
+		DocURL:   expand(p.pkg.DocURL),
+		DocBadge: expand(p.pkg.DocBadge),
+		MovedTo:  expand(p.pkg.MovedTo),
+
+		BrowserRedirect: expand(p.pkg.BrowserRedirect),
+
+		Status:        p.pkg.Status,
+		StatusMessage: expand(p.pkg.StatusMessage),
+		Replacement:   expand(p.pkg.Replacement),
+	})
+	pkg.pattern = p.Pattern
+	return pkg
+}
+
+// sortPatterns orders patterns in the order they're tried:
+// longer patterns first, which are usually more specific,
+// with ties broken alphabetically.
+func sortPatterns(patterns []*sallyPattern) {
+	slices.SortFunc(patterns, func(a, b *sallyPattern) int {
+		return cmp.Or(
+			cmp.Compare(len(b.Pattern), len(a.Pattern)),
+			cmp.Compare(a.Pattern, b.Pattern),
+		)
+	})
+}
+
+// matchPattern finds the package served for the given request path
+// by the first pattern that matches it or one of its parent directories.
+// Longer names are preferred, so that "foo/bar" is tried before "foo".
+//
+// The search stops at directories containing explicit packages in tree:
+// those are served by the explicit packages, not by patterns.
+func matchPattern(patterns []*sallyPattern, tree *packageTree, reqPath string) *sallyPackage {
+	for name := reqPath; name != "." && name != "/" && name != ""; name = path.Dir(name) {
+		if tree.find(name) != nil {
+			return nil
+		}
+		for _, p := range patterns {
+			if pkg := p.resolve(name); pkg != nil {
+				return pkg
+			}
+		}
+	}
+	return nil
+}
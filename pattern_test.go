@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var patternConfig = `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+  net/metrics:
+    repo: github.com/yarpc/metrics
+  "*":
+    repo: github.com/uber-go/{name}
+    description: Uber's {name} library.
+  "contrib/*-go":
+    repo: github.com/uber-contrib/{1}
+    subdir: go
+  "^(?P<lang>go|rust)-(\\w+)$":
+    repo: github.com/uber-{lang}/{2}
+`
+
+func TestCompilePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    []string // submatches, or nil if no match
+	}{
+		{pattern: "*", name: "foo", want: []string{"foo", "foo"}},
+		{pattern: "*", name: "foo/bar"},
+		{pattern: "foo/*", name: "foo/bar", want: []string{"foo/bar", "bar"}},
+		{pattern: "foo/*", name: "foo/"},
+		{pattern: "*-go", name: "yarpc-go", want: []string{"yarpc-go", "yarpc"}},
+		{pattern: "*/*", name: "a/b", want: []string{"a/b", "a", "b"}},
+		{pattern: "a.b/*", name: "aXb/c"},
+		{pattern: "^lib-(.+)", name: "lib-foo/bar", want: []string{"lib-foo/bar", "foo/bar"}},
+		{pattern: "^lib|other", name: "otherlib"},
+		{pattern: "^lib|other", name: "other", want: []string{"other"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			re, err := compilePattern(tt.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, re.FindStringSubmatch(tt.name))
+		})
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	tests := []struct {
+		desc       string
+		path       string
+		wantCode   int
+		wantMeta   string
+		wantDocs   string
+		wantInBody string
+	}{
+		{
+			desc:     "explicit package wins",
+			path:     "/zap",
+			wantCode: http.StatusOK,
+			wantMeta: "go.uber.org/zap git https://github.com/uber-go/zap",
+		},
+		{
+			desc:     "glob",
+			path:     "/atomic",
+			wantCode: http.StatusOK,
+			wantMeta: "go.uber.org/atomic git https://github.com/uber-go/atomic",
+			wantDocs: "https://pkg.go.dev/go.uber.org/atomic",
+		},
+		{
+			desc:     "glob subpackage",
+			path:     "/atomic/internal/x",
+			wantCode: http.StatusOK,
+			wantMeta: "go.uber.org/atomic git https://github.com/uber-go/atomic",
+			wantDocs: "https://pkg.go.dev/go.uber.org/atomic/internal/x",
+		},
+		{
+			desc:     "longer pattern wins",
+			path:     "/contrib/kafka-go",
+			wantCode: http.StatusOK,
+			wantMeta: "go.uber.org/contrib/kafka-go git https://github.com/uber-contrib/kafka go",
+		},
+		{
+			desc:     "regexp",
+			path:     "/rust-fx",
+			wantCode: http.StatusOK,
+			wantMeta: "go.uber.org/rust-fx git https://github.com/uber-rust/fx",
+		},
+		{
+			desc:       "directory of explicit packages wins",
+			path:       "/net",
+			wantCode:   http.StatusOK,
+			wantInBody: "github.com/yarpc/metrics",
+		},
+		{
+			desc:     "parent directory matches",
+			path:     "/contrib/kafka",
+			wantCode: http.StatusOK,
+			wantMeta: "go.uber.org/contrib git https://github.com/uber-go/contrib",
+			wantDocs: "https://pkg.go.dev/go.uber.org/contrib/kafka",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			rr := CallAndRecord(t, patternConfig, getTestTemplates(t, nil), tt.path)
+			assert.Equal(t, tt.wantCode, rr.Code)
+
+			body := rr.Body.String()
+			if tt.wantMeta != "" {
+				assert.Contains(t, body, `<meta name="go-import" content="`+tt.wantMeta+`">`)
+			}
+			if tt.wantDocs != "" {
+				assert.Contains(t, body, "url="+tt.wantDocs+`"`)
+			}
+			if tt.wantInBody != "" {
+				assert.Contains(t, body, tt.wantInBody)
+			}
+		})
+	}
+}
+
+func TestPatternsIndex(t *testing.T) {
+	templates := getTestTemplates(t, nil)
+
+	t.Run("html", func(t *testing.T) {
+		rr := CallAndRecord(t, patternConfig, templates, "/")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		body := rr.Body.String()
+		assert.Contains(t, body, "github.com/uber-go/zap")
+		assert.Contains(t, body, "<code>go.uber.org/contrib/*-go</code>")
+		assert.Contains(t, body, "<code>github.com/uber-contrib/{1}</code>")
+		assert.Contains(t, body, "Uber&#39;s {name} library.")
+	})
+
+	t.Run("subindex", func(t *testing.T) {
+		rr := CallAndRecord(t, patternConfig, templates, "/net")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "github.com/uber-go/{name}")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		rr := CallAndRecord(t, patternConfig, templates, "/api/packages")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Packages []struct{ Name string }
+			Patterns []struct{ Pattern, Repo string }
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+		assert.Len(t, res.Packages, 2)
+		require.Len(t, res.Patterns, 3)
+		assert.Equal(t, "github.com/uber-{lang}/{2}", res.Patterns[0].Repo)
+		assert.Equal(t, "contrib/*-go", res.Patterns[1].Pattern)
+		assert.Equal(t, "*", res.Patterns[2].Pattern)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		rr := CallAndRecord(t, `
+url: go.uber.org
+packages:
+  "contrib/*-go":
+    repo: github.com/uber-contrib/{1}
+`, templates, "/contrib/kafka")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("directory of explicit packages", func(t *testing.T) {
+		config := `
+url: go.uber.org
+packages:
+  lib/foo/bar:
+    repo: github.com/uber-go/bar
+  "lib/*":
+    repo: github.com/uber-go/{1}
+`
+		rr := CallAndRecord(t, config, templates, "/lib/foo/baz?go-get=1")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "go.uber.org/lib/foo git")
+
+		rr = CallAndRecord(t, config, templates, "/lib/foo?go-get=1")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "github.com/uber-go/bar")
+		assert.NotContains(t, rr.Body.String(), "go.uber.org/lib/foo git")
+
+		rr = CallAndRecord(t, config, templates, "/lib/qux/x?go-get=1")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `<meta name="go-import" content="go.uber.org/lib/qux git https://github.com/uber-go/qux">`)
+	})
+
+	t.Run("only patterns", func(t *testing.T) {
+		rr := CallAndRecord(t, `
+url: go.uber.org
+packages:
+  "*":
+    repo: github.com/uber-go/{name}
+`, templates, "/")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "github.com/uber-go/{name}")
+	})
+}
+
+func TestPatternsMetricsLabel(t *testing.T) {
+	handler := CreateHandlerFromYAML(t, getTestTemplates(t, nil), patternConfig)
+
+	var info *requestInfo
+	req := httptest.NewRequest("GET", "/atomic?go-get=1", nil)
+	req, info = withRequestInfo(req)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "package", info.Handler)
+	assert.Equal(t, "atomic", info.Package)
+	assert.Equal(t, "*", info.Pattern)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reloader serves requests with a handler built from the configuration file
+// at path. The handler is rebuilt when the file changes or when Reload is
+// called, and swapped in atomically only if the new configuration loads
+// successfully. Until then, the previous handler keeps serving requests.
+type reloader struct {
+	path   string
+	build  func(*Config) (http.Handler, error)
+	logger *log.Logger
+
+	// mu serializes reloads.
+	mu sync.Mutex
+
+	// lastHash is the hash of the most recent contents that we attempted
+	// to load, successfully or not. It prevents watch from retrying a
+	// broken configuration until the file changes again.
+	lastHash string
+
+	current atomic.Pointer[loadedConfig]
+}
+
+var _ http.Handler = (*reloader)(nil)
+
+// loadedConfig is a configuration that was loaded successfully
+// and the handler built from it.
+type loadedConfig struct {
+	Config  *Config
+	Hash    string // hex-encoded SHA-256 of the configuration file
+	Handler http.Handler
+}
+
+func newReloader(path string, build func(*Config) (http.Handler, error), logger *log.Logger) *reloader {
+	return &reloader{
+		path:   path,
+		build:  build,
+		logger: logger,
+	}
+}
+
+// Current returns the most recently loaded configuration,
+// or nil if no configuration has been loaded yet.
+func (r *reloader) Current() *loadedConfig {
+	return r.current.Load()
+}
+
+// Reload reads the configuration file and swaps in a handler built from it.
+// If the configuration cannot be loaded, the current handler is retained
+// and an error is returned.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	return r.load(data)
+}
+
+// reloadIfChanged reloads the configuration file
+// only if its contents changed since the last attempt.
+func (r *reloader) reloadIfChanged() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	if hashConfig(data) == r.lastHash {
+		return nil
+	}
+	return r.load(data)
+}
+
+func (r *reloader) load(data []byte) error {
+	hash := hashConfig(data)
+	r.lastHash = hash
+
+	config, err := parseConfig(data)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", r.path, err)
+	}
+
+	handler, err := r.build(config)
+	if err != nil {
+		return fmt.Errorf("create handler: %w", err)
+	}
+
+	old := r.current.Swap(&loadedConfig{
+		Config:  config,
+		Hash:    hash,
+		Handler: handler,
+	})
+	if old == nil {
+		r.logger.Printf("Loaded %s with %d packages", r.path, len(config.Packages))
+		return nil
+	}
+
+	added, removed, modified := diffPackages(old.Config.Packages, config.Packages)
+	r.logger.Printf("Reloaded %s: added %q, removed %q, modified %q",
+		r.path, added, removed, modified)
+	if !reflect.DeepEqual(old.Config.Server, config.Server) ||
+		!reflect.DeepEqual(old.Config.Listeners, config.Listeners) ||
+		!reflect.DeepEqual(old.Config.TLS, config.TLS) {
+		r.logger.Printf("Server settings in %s changed; restart to apply them", r.path)
+	}
+	return nil
+}
+
+// Watch polls the configuration file every interval
+// and reloads it when its contents change.
+// It blocks until ctx is cancelled.
+func (r *reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.reloadIfChanged(); err != nil {
+				r.logger.Printf("Failed to reload %s, keeping previous configuration: %v", r.path, err)
+			}
+		}
+	}
+}
+
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	current := r.current.Load()
+	if current == nil {
+		http.Error(w, errNotLoaded.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	current.Handler.ServeHTTP(w, req)
+}
+
+var errNotLoaded = errors.New("configuration not loaded")
+
+func hashConfig(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// diffPackages reports the names of packages that were added, removed,
+// or modified between two package configurations, sorted by name.
+func diffPackages(old, new map[string]PackageConfig) (added, removed, modified []string) {
+	for name, pkg := range new {
+		oldPkg, ok := old[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case !reflect.DeepEqual(oldPkg, pkg):
+			modified = append(modified, name)
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(modified)
+	return added, removed, modified
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader(t *testing.T) {
+	path := TempFile(t, `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+  yarpc:
+    repo: github.com/yarpc/yarpc-go
+`)
+
+	var logs bytes.Buffer
+	templates := getTestTemplates(t, nil)
+	r := newReloader(path, func(c *Config) (http.Handler, error) {
+		return CreateHandler(c, templates)
+	}, log.New(&logs, "", 0))
+
+	assert.Equal(t, http.StatusServiceUnavailable, serve(r, "/zap").Code,
+		"must not serve before loading")
+
+	require.NoError(t, r.Reload())
+	assert.Equal(t, http.StatusOK, serve(r, "/zap").Code)
+	assert.Equal(t, http.StatusNotFound, serve(r, "/atomic").Code)
+
+	t.Run("valid change", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+    description: A fast, structured logging library.
+  atomic:
+    repo: github.com/uber-go/atomic
+`), 0o644))
+		require.NoError(t, r.Reload())
+
+		assert.Equal(t, http.StatusOK, serve(r, "/atomic").Code)
+		assert.Equal(t, http.StatusNotFound, serve(r, "/yarpc").Code)
+		assert.Contains(t, logs.String(),
+			`added ["atomic"], removed ["yarpc"], modified ["zap"]`)
+	})
+
+	t.Run("invalid change", func(t *testing.T) {
+		before := r.Current()
+		require.NoError(t, os.WriteFile(path, []byte("packages: ["), 0o644))
+		require.Error(t, r.Reload())
+
+		assert.Same(t, before, r.Current(), "previous configuration must be retained")
+		assert.Equal(t, http.StatusOK, serve(r, "/atomic").Code)
+	})
+}
+
+func TestReloaderBuildError(t *testing.T) {
+	path := TempFile(t, "url: go.uber.org")
+
+	r := newReloader(path, func(*Config) (http.Handler, error) {
+		return nil, assert.AnError
+	}, log.New(&bytes.Buffer{}, "", 0))
+
+	err := r.Reload()
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Nil(t, r.Current())
+}
+
+func TestReloaderWatch(t *testing.T) {
+	path := TempFile(t, `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+`)
+
+	templates := getTestTemplates(t, nil)
+	r := newReloader(path, func(c *Config) (http.Handler, error) {
+		return CreateHandler(c, templates)
+	}, log.New(&bytes.Buffer{}, "", 0))
+	require.NoError(t, r.Reload())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Watch(ctx, time.Millisecond)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+url: go.uber.org
+packages:
+  atomic:
+    repo: github.com/uber-go/atomic
+`), 0o644))
+
+	assert.Eventually(t, func() bool {
+		return serve(r, "/atomic").Code == http.StatusOK
+	}, time.Second, time.Millisecond)
+}
+
+func TestDiffPackages(t *testing.T) {
+	added, removed, modified := diffPackages(
+		map[string]PackageConfig{
+			"a": {Repo: "github.com/x/a"},
+			"b": {Repo: "github.com/x/b"},
+			"c": {Repo: "github.com/x/c"},
+		},
+		map[string]PackageConfig{
+			"b": {Repo: "github.com/x/b"},
+			"c": {Repo: "github.com/y/c"},
+			"e": {Repo: "github.com/x/e"},
+			"d": {Repo: "github.com/x/d"},
+		},
+	)
+	assert.Equal(t, []string{"d", "e"}, added)
+	assert.Equal(t, []string{"a"}, removed)
+	assert.Equal(t, []string{"c"}, modified)
+}
+
+func serve(h http.Handler, uri string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", uri, nil))
+	return rr
+}
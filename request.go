@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// requestInfo holds details about how sally handled a request.
+// Handlers fill it in so that middleware can report on it.
+type requestInfo struct {
+	// Handler is the name of the handler that served the request,
+	// e.g. "package" or "index".
+	// Empty if the request was not served by any handler.
+	Handler string
+
+	// Package is the name of the package that matched the request, if any.
+	Package string
+
+	// Pattern is the pattern that the package was resolved from,
+	// if it didn't match an explicitly listed package.
+	Pattern string
+}
+
+type requestInfoKey struct{}
+
+// withRequestInfo attaches a new requestInfo to the request.
+// Handlers record details into it with annotateRequest.
+func withRequestInfo(r *http.Request) (*http.Request, *requestInfo) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		// Already attached by another middleware.
+		return r, info
+	}
+
+	info := new(requestInfo)
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)), info
+}
+
+// annotateRequest records the handler and package that served the request.
+// pkg is nil if the request wasn't served for a package.
+// It does nothing if the request has no requestInfo attached.
+func annotateRequest(r *http.Request, handler string, pkg *sallyPackage) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.Handler = handler
+		if pkg != nil {
+			info.Package = pkg.Name
+			info.Pattern = pkg.pattern
+		}
+	}
+}
+
+// isGoGet reports whether the request was made by the go command
+// resolving an import path.
+func isGoGet(r *http.Request) bool {
+	return r.URL.Query().Get("go-get") == "1"
+}
+
+// responseRecorder wraps an http.ResponseWriter,
+// recording the status code and the number of bytes written.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	Status int
+	Bytes  int64
+}
+
+var _ http.ResponseWriter = (*responseRecorder)(nil)
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.Status == 0 {
+		w.Status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.Status == 0 {
+		w.Status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.Bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter
+// for use with http.ResponseController.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// StatusCode returns the status code of the response,
+// defaulting to 200 if the handler didn't write anything.
+func (w *responseRecorder) StatusCode() int {
+	if w.Status == 0 {
+		return http.StatusOK
+	}
+	return w.Status
+}
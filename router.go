@@ -0,0 +1,162 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"strings"
+)
+
+// comparePackageNames orders package names so that
+// every package is followed by the packages under it.
+// Names are compared segment by segment,
+// so "foo/bar" comes before "foo-bar".
+func comparePackageNames(a, b string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		ca, cb := a[i], b[i]
+		switch {
+		case ca == cb:
+			continue
+		case ca == '/':
+			return -1
+		case cb == '/':
+			return 1
+		default:
+			return cmp.Compare(ca, cb)
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// packageTree is a prefix tree of package names
+// with a node for each path segment.
+type packageTree struct {
+	root packageNode
+}
+
+type packageNode struct {
+	children map[string]*packageNode
+
+	// Index of the package whose name ends at this node,
+	// or -1 if the node is only a directory.
+	pkg int
+
+	// Range of packages at or under this node.
+	start, end int
+}
+
+// newPackageTree builds a tree of the given package names,
+// which must be sorted by comparePackageNames.
+// Packages are identified by their index in names.
+func newPackageTree(names []string) *packageTree {
+	t := &packageTree{root: packageNode{pkg: -1, end: len(names)}}
+	for i, name := range names {
+		n := &t.root
+		for rest := name; rest != ""; {
+			var seg string
+			seg, rest, _ = strings.Cut(rest, "/")
+
+			child, ok := n.children[seg]
+			if !ok {
+				// Names are sorted so that the packages under a node
+				// are adjacent, and the first of them creates it.
+				child = &packageNode{pkg: -1, start: i}
+				if n.children == nil {
+					n.children = make(map[string]*packageNode)
+				}
+				n.children[seg] = child
+			}
+			child.end = i + 1
+			n = child
+		}
+		n.pkg = i
+	}
+	return t
+}
+
+// find returns the node for the given package name or directory,
+// or nil if there are no packages under it.
+// The empty name refers to the root.
+func (t *packageTree) find(name string) *packageNode {
+	n := &t.root
+	for rest := name; rest != "" && n != nil; {
+		var seg string
+		seg, rest, _ = strings.Cut(rest, "/")
+		n = n.children[seg]
+	}
+	return n
+}
+
+// lookup walks the tree along a request path like "/foo/bar".
+//
+// If the path names a package or something under it,
+// lookup returns the index of the package with the longest such name,
+// and the rest of the path relative to that package.
+// Otherwise, pkg is -1, and dir is the node for the path
+// if it's a directory containing packages, or nil.
+func (t *packageTree) lookup(urlPath string) (pkg int, relPath string, dir *packageNode) {
+	pkg = -1
+	n, rest := &t.root, urlPath
+	for {
+		if n.pkg >= 0 {
+			pkg, relPath = n.pkg, rest
+		}
+		if rest == "" || rest == "/" {
+			dir = n
+			break
+		}
+		if rest[0] != '/' {
+			break
+		}
+
+		seg, _, _ := strings.Cut(rest[1:], "/")
+		child, ok := n.children[seg]
+		if !ok {
+			break
+		}
+		n, rest = child, rest[1+len(seg):]
+	}
+
+	if pkg >= 0 {
+		dir = nil
+	}
+	return pkg, relPath, dir
+}
+
+// walk calls fn for every node in the tree with its name.
+func (t *packageTree) walk(fn func(name string, n *packageNode)) {
+	var visit func(name string, n *packageNode)
+	visit = func(name string, n *packageNode) {
+		fn(name, n)
+		for seg, child := range n.children {
+			if name != "" {
+				seg = name + "/" + seg
+			}
+			visit(seg, child)
+		}
+	}
+	visit("", &t.root)
+}
+
+// packageRouter routes requests to the package, directory index,
+// or pattern that serves them.
+type packageRouter struct {
+	index    *indexHandler
+	packages []*packageHandler // same order as index.pkgs
+}
+
+var _ http.Handler = (*packageRouter)(nil)
+
+func (rt *packageRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pkg, _, dir := rt.index.tree.lookup(r.URL.Path)
+	if pkg >= 0 {
+		rt.packages[pkg].ServeHTTP(w, r)
+		return
+	}
+
+	var start, end int
+	if dir != nil {
+		start, end = dir.start, dir.end
+	}
+	path := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/"), "/")
+	rt.index.serveDir(w, r, path, start, end)
+}
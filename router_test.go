@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComparePackageNames(t *testing.T) {
+	names := []string{"foo-bar", "foo/bar", "foo.x", "a", "foo", "foo/bar/baz", "foo/bar-baz"}
+	slices.SortFunc(names, comparePackageNames)
+	assert.Equal(t, []string{
+		"a",
+		"foo",
+		"foo/bar",
+		"foo/bar/baz",
+		"foo/bar-baz",
+		"foo-bar",
+		"foo.x",
+	}, names)
+}
+
+func TestPackageTreeLookup(t *testing.T) {
+	names := []string{"foo", "foo/bar/baz", "foo-bar", "net/metrics", "net/something"}
+	slices.SortFunc(names, comparePackageNames)
+	tree := newPackageTree(names)
+
+	tests := []struct {
+		path        string
+		wantPkg     string // package name, if any
+		wantRelPath string
+		wantDir     []string // packages in the directory, if any
+	}{
+		{path: "/", wantDir: names},
+		{path: "/foo", wantPkg: "foo"},
+		{path: "/foo/", wantPkg: "foo", wantRelPath: "/"},
+		{path: "/foo/bar", wantPkg: "foo", wantRelPath: "/bar"},
+		{path: "/foo/bar/baz", wantPkg: "foo/bar/baz"},
+		{path: "/foo/bar/baz/qux", wantPkg: "foo/bar/baz", wantRelPath: "/qux"},
+		{path: "/foo-bar/x", wantPkg: "foo-bar", wantRelPath: "/x"},
+		{path: "/net", wantDir: []string{"net/metrics", "net/something"}},
+		{path: "/net/", wantDir: []string{"net/metrics", "net/something"}},
+		{path: "/net/metricsx"},
+		{path: "/nope"},
+		{path: "/net//metrics"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			pkg, relPath, dir := tree.lookup(tt.path)
+			if tt.wantPkg != "" {
+				require.GreaterOrEqual(t, pkg, 0, "expected a package")
+				assert.Equal(t, tt.wantPkg, names[pkg])
+				assert.Equal(t, tt.wantRelPath, relPath)
+				assert.Nil(t, dir)
+				return
+			}
+
+			assert.Equal(t, -1, pkg)
+			if tt.wantDir == nil {
+				assert.Nil(t, dir)
+				return
+			}
+			require.NotNil(t, dir)
+			assert.Equal(t, tt.wantDir, names[dir.start:dir.end])
+		})
+	}
+}
+
+func TestPackageTreeEmpty(t *testing.T) {
+	tree := newPackageTree(nil)
+	pkg, _, dir := tree.lookup("/")
+	assert.Equal(t, -1, pkg)
+	require.NotNil(t, dir)
+	assert.Equal(t, 0, dir.end)
+
+	pkg, _, dir = tree.lookup("/foo")
+	assert.Equal(t, -1, pkg)
+	assert.Nil(t, dir)
+}
+
+// routingCase is a randomly generated set of package names
+// and request paths.
+type routingCase struct {
+	Names []string
+	Paths []string
+}
+
+var _ quick.Generator = routingCase{}
+
+// Segments are chosen from a small set with shared prefixes
+// so that names often contain or neighbor each other.
+var _routingSegments = []string{"a", "b", "ab", "a-b", "a.b", "b_c"}
+
+func randomRoutingPath(r *rand.Rand, maxSegments int) string {
+	segs := make([]string, 1+r.Intn(maxSegments))
+	for i := range segs {
+		segs[i] = _routingSegments[r.Intn(len(_routingSegments))]
+	}
+	return strings.Join(segs, "/")
+}
+
+func (routingCase) Generate(r *rand.Rand, size int) reflect.Value {
+	var c routingCase
+	seen := make(map[string]struct{})
+	for i := r.Intn(size + 1); i > 0; i-- {
+		name := randomRoutingPath(r, 3)
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			c.Names = append(c.Names, name)
+		}
+	}
+
+	c.Paths = []string{"/"}
+	for i := 0; i < 20; i++ {
+		p := "/" + randomRoutingPath(r, 4)
+		if r.Intn(4) == 0 {
+			p += "/"
+		}
+		c.Paths = append(c.Paths, p)
+	}
+	return reflect.ValueOf(c)
+}
+
+// TestPackageTreeMatchesServeMux checks that the package tree
+// routes requests like an http.ServeMux with every package registered
+// as both "/name" and "/name/", and that directories list
+// every package that descends from them.
+func TestPackageTreeMatchesServeMux(t *testing.T) {
+	check := func(c routingCase) bool {
+		mux := http.NewServeMux()
+		for _, name := range c.Names {
+			mux.Handle("/"+name, http.NotFoundHandler())
+			mux.Handle("/"+name+"/", http.NotFoundHandler())
+		}
+		mux.Handle("/", http.NotFoundHandler())
+
+		names := slices.Clone(c.Names)
+		slices.SortFunc(names, comparePackageNames)
+		tree := newPackageTree(names)
+
+		ok := true
+		for _, p := range c.Paths {
+			_, pattern := mux.Handler(httptest.NewRequest("GET", p, nil))
+			pkg, relPath, dir := tree.lookup(p)
+
+			if pattern != "/" {
+				want := strings.Trim(pattern, "/")
+				if pkg < 0 || names[pkg] != want || relPath != strings.TrimPrefix(p, "/"+want) {
+					t.Errorf("names %q: %v: want package %q, got %v, %q", c.Names, p, want, pkg, relPath)
+					ok = false
+				}
+				continue
+			}
+
+			if pkg >= 0 {
+				t.Errorf("names %q: %v: want index, got package %q", c.Names, p, names[pkg])
+				ok = false
+				continue
+			}
+
+			dirName := strings.Trim(p, "/")
+			var want, got []string
+			for _, name := range names {
+				if dirName == "" || descends(dirName, name) {
+					want = append(want, name)
+				}
+			}
+			if dir != nil {
+				got = names[dir.start:dir.end]
+			}
+			if !slices.Equal(want, got) && (len(want) > 0 || len(got) > 0) {
+				t.Errorf("names %q: %v: want directory %q, got %q", c.Names, p, want, got)
+				ok = false
+			}
+		}
+		return ok
+	}
+
+	require.NoError(t, quick.Check(check, &quick.Config{MaxCount: 500}))
+}
+
+func TestPackageTreeFind(t *testing.T) {
+	check := func(c routingCase) bool {
+		names := slices.Clone(c.Names)
+		slices.SortFunc(names, comparePackageNames)
+		tree := newPackageTree(names)
+
+		for _, p := range append(c.Paths, c.Names...) {
+			p = strings.Trim(p, "/")
+
+			var want []string
+			for _, name := range names {
+				if p == "" || descends(p, name) {
+					want = append(want, name)
+				}
+			}
+
+			var got []string
+			if n := tree.find(p); n != nil {
+				got = names[n.start:n.end]
+			}
+			if !slices.Equal(want, got) && (len(want) > 0 || len(got) > 0) {
+				t.Errorf("names %q: find %q: want %q, got %q", c.Names, p, want, got)
+				return false
+			}
+		}
+		return true
+	}
+
+	require.NoError(t, quick.Check(check, &quick.Config{MaxCount: 500}))
+}
+
+// benchmarkPackageNames returns n package names
+// spread across nested directories.
+func benchmarkPackageNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("group%d/sub%d/pkg%d", i%50, i%7, i)
+	}
+	slices.SortFunc(names, comparePackageNames)
+	return names
+}
+
+// BenchmarkRouting compares looking up packages in the package tree
+// with an http.ServeMux holding two patterns for every package.
+func BenchmarkRouting(b *testing.B) {
+	for _, n := range []int{10000, 100000} {
+		names := benchmarkPackageNames(n)
+		paths := []string{
+			"/" + names[n/2],
+			"/" + names[n/2] + "/internal/x",
+			"/group3/sub1",
+			"/nope",
+		}
+
+		b.Run(fmt.Sprintf("packages=%d/build/tree", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				newPackageTree(names)
+			}
+		})
+
+		tree := newPackageTree(names)
+		b.Run(fmt.Sprintf("packages=%d/lookup/tree", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tree.lookup(paths[i%len(paths)])
+			}
+		})
+
+		// Registering patterns on an http.ServeMux takes quadratic time,
+		// so it's only compared for smaller configurations.
+		if n > 10000 {
+			continue
+		}
+
+		b.Run(fmt.Sprintf("packages=%d/build/servemux", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				mux := http.NewServeMux()
+				for _, name := range names {
+					mux.Handle("/"+name, http.NotFoundHandler())
+					mux.Handle("/"+name+"/", http.NotFoundHandler())
+				}
+			}
+		})
+
+		mux := http.NewServeMux()
+		for _, name := range names {
+			mux.Handle("/"+name, http.NotFoundHandler())
+			mux.Handle("/"+name+"/", http.NotFoundHandler())
+		}
+		reqs := make([]*http.Request, len(paths))
+		for i, p := range paths {
+			reqs[i] = httptest.NewRequest("GET", p, nil)
+		}
+		b.Run(fmt.Sprintf("packages=%d/lookup/servemux", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				mux.Handler(reqs[i%len(reqs)])
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// newServer builds an http.Server serving handler with the given settings.
+func newServer(cfg ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// boundServer is an http.Server paired with the listener it serves on.
+type boundServer struct {
+	Server   *http.Server
+	Listener net.Listener
+}
+
+// serve serves requests on the listener,
+// over TLS if the server has a TLS configuration.
+func (b boundServer) serve() error {
+	if b.Server.TLSConfig != nil {
+		// Certificates are provided by the TLS configuration.
+		return b.Server.ServeTLS(b.Listener, "", "")
+	}
+	return b.Server.Serve(b.Listener)
+}
+
+// runServers serves HTTP requests on all the given servers
+// until ctx is cancelled or any of them fails.
+// It then stops accepting new connections and waits up to shutdownTimeout
+// for in-flight requests to complete before closing remaining connections.
+func runServers(ctx context.Context, shutdownTimeout time.Duration, servers ...boundServer) error {
+	errc := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s boundServer) {
+			errc <- s.serve()
+		}(s)
+	}
+
+	var (
+		errs     []error
+		received int // number of results read from errc
+	)
+	select {
+	case err := <-errc:
+		// A server failed before we were asked to stop.
+		// Stop the others as well.
+		errs = append(errs, err)
+		received++
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %v for in-flight requests", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for _, s := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				// Grace period expired. Drop the remaining connections.
+				_ = srv.Close()
+
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(s.Server)
+	}
+	wg.Wait()
+
+	// Collect the results of servers that haven't reported yet.
+	for ; received < len(servers); received++ {
+		if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewServer(t *testing.T) {
+	handler := http.NotFoundHandler()
+	srv := newServer(_defaultServerConfig, handler)
+
+	assert.Equal(t, 10*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 30*time.Second, srv.ReadTimeout)
+	assert.Equal(t, 30*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 2*time.Minute, srv.IdleTimeout)
+	assert.Equal(t, http.DefaultMaxHeaderBytes, srv.MaxHeaderBytes)
+}
+
+func TestRunServersDrainsRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	cfg := _defaultServerConfig
+	cfg.ShutdownTimeout = 5 * time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- runServers(ctx, cfg.ShutdownTimeout, boundServer{newServer(cfg, handler), ln})
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			resc <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		resc <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	// The server must stop accepting new connections...
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// ...but finish the in-flight request.
+	close(release)
+	res := <-resc
+	require.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+	assert.NoError(t, <-done)
+}
+
+func TestRunServersShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	cfg := _defaultServerConfig
+	cfg.ShutdownTimeout = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- runServers(ctx, cfg.ShutdownTimeout, boundServer{newServer(cfg, handler), ln})
+	}()
+
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String())
+		if err == nil {
+			_ = res.Body.Close()
+		}
+	}()
+
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+}
+
+func TestRunServersStopsAllOnFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	// A closed listener makes its server fail immediately.
+	broken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, broken.Close())
+
+	cfg := _defaultServerConfig
+	err = runServers(context.Background(), time.Second,
+		boundServer{newServer(cfg, http.NotFoundHandler()), ln},
+		boundServer{newServer(cfg, http.NotFoundHandler()), broken},
+	)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, net.ErrClosed)
+
+	_, err = net.Dial("tcp", ln.Addr().String())
+	assert.Error(t, err, "healthy server must be stopped too")
+}
+
+func TestServerConfig(t *testing.T) {
+	t.Run("custom", func(t *testing.T) {
+		config, err := Parse(TempFile(t, `
+url: go.uber.org
+server:
+  read_header_timeout: 1s
+  write_timeout: 1m
+  max_header_bytes: 4096
+  shutdown_timeout: 5s
+`))
+		require.NoError(t, err)
+
+		want := _defaultServerConfig
+		want.ReadHeaderTimeout = time.Second
+		want.WriteTimeout = time.Minute
+		want.MaxHeaderBytes = 4096
+		want.ShutdownTimeout = 5 * time.Second
+		assert.Equal(t, want, config.Server)
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		_, err := Parse(TempFile(t, `
+url: go.uber.org
+server:
+  idle_timeout: -1s
+`))
+		require.Error(t, err)
+		assert.Equal(t, "4:17: server.idle_timeout must not be negative: -1s", err.Error())
+	})
+}
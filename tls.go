@@ -0,0 +1,163 @@
+package main
+
+import (
+	"cmp"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// _tlsVersions maps the values accepted for tls.min_version
+// to their crypto/tls constants.
+var _tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig builds a TLS configuration that serves the certificate
+// in cfg, reloading it when the files change.
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("both a certificate and a key file are required for TLS")
+	}
+
+	minVersion := uint16(tls.VersionTLS12)
+	if cfg.MinVersion != "" {
+		v, ok := _tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q", cfg.MinVersion)
+		}
+		minVersion = v
+	}
+
+	certs, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: certs.GetCertificate,
+	}, nil
+}
+
+// overrideTLSFiles returns cfg with its certificate and key files
+// replaced by the -tls-cert and -tls-key flags.
+// Each flag overrides its own file only if it's set.
+func overrideTLSFiles(cfg TLSConfig, certFile, keyFile string) TLSConfig {
+	cfg.CertFile = cmp.Or(certFile, cfg.CertFile)
+	cfg.KeyFile = cmp.Or(keyFile, cfg.KeyFile)
+	return cfg
+}
+
+// _certCheckInterval is the minimum time between checks
+// for changes to the certificate files.
+const _certCheckInterval = time.Second
+
+// certReloader provides a TLS certificate loaded from files on disk,
+// reloading it when the files are modified.
+//
+// If a modified certificate cannot be loaded,
+// the previous certificate continues to be served.
+type certReloader struct {
+	certFile, keyFile string
+	checkInterval     time.Duration
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time // modification time of certFile when cert was loaded
+	keyMod  time.Time // modification time of keyFile when cert was loaded
+	checked time.Time // last time we checked for changes
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		checkInterval: _certCheckInterval,
+	}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate returns the current certificate.
+// It satisfies the signature of tls.Config.GetCertificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now := time.Now(); now.Sub(c.checked) >= c.checkInterval {
+		c.checked = now
+		if err := c.reload(); err != nil {
+			log.Printf("Failed to reload TLS certificate, keeping previous certificate: %v", err)
+		}
+	}
+	return c.cert, nil
+}
+
+// reload loads the certificate if either file changed since it was
+// last loaded. c.mu must be held, unless c is not yet shared.
+func (c *certReloader) reload() error {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	if c.cert != nil && certInfo.ModTime().Equal(c.certMod) && keyInfo.ModTime().Equal(c.keyMod) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	if c.cert != nil {
+		log.Printf("Reloaded TLS certificate from %s", c.certFile)
+	}
+	c.cert = &cert
+	c.certMod = certInfo.ModTime()
+	c.keyMod = keyInfo.ModTime()
+	return nil
+}
+
+// redirectToHTTPS returns a handler that permanently redirects requests
+// to the same URL over HTTPS on the given port.
+// The port is omitted from the URL if it's empty or 443.
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hostname := (&url.URL{Host: r.Host}).Hostname()
+		host := hostname
+		switch {
+		case httpsPort != "" && httpsPort != "443":
+			host = net.JoinHostPort(hostname, httpsPort)
+		case strings.Contains(hostname, ":"):
+			// IPv6 literals must be bracketed.
+			host = "[" + hostname + "]"
+		}
+
+		u := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+		}
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	})
+}
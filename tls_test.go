@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert generates a self-signed certificate for localhost
+// and writes it and its key to the given files.
+// It returns the parsed certificate.
+func writeTestCert(t *testing.T, certFile, keyFile, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	require.NoError(t, os.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return cert
+}
+
+func TestTLSServing(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	cert := writeTestCert(t, certFile, keyFile, "sally")
+
+	tlsConfig, err := newTLSConfig(TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := newServer(_defaultServerConfig, CreateHandlerFromYAML(t, getTestTemplates(t, nil), config))
+	srv.TLSConfig = tlsConfig
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runServers(ctx, time.Second, boundServer{Server: srv, Listener: ln})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, ServerName: "localhost"},
+			ForceAttemptHTTP2: true,
+		},
+	}
+
+	res, err := client.Get("https://" + ln.Addr().String() + "/zap")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "sally", res.TLS.PeerCertificates[0].Subject.CommonName)
+	assert.Equal(t, "HTTP/2.0", res.Proto)
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "sally")
+
+	t.Run("min version", func(t *testing.T) {
+		cfg, err := newTLSConfig(TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"})
+		require.NoError(t, err)
+		assert.Equal(t, uint16(tls.VersionTLS13), cfg.MinVersion)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		_, err := newTLSConfig(TLSConfig{CertFile: certFile})
+		assert.Error(t, err)
+	})
+
+	t.Run("bad version", func(t *testing.T) {
+		_, err := newTLSConfig(TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "2.0"})
+		assert.Error(t, err)
+	})
+
+	t.Run("bad files", func(t *testing.T) {
+		_, err := newTLSConfig(TLSConfig{CertFile: keyFile, KeyFile: certFile})
+		assert.Error(t, err)
+	})
+}
+
+func TestOverrideTLSFiles(t *testing.T) {
+	cfg := TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.3"}
+
+	tests := []struct {
+		desc      string
+		cert, key string
+		wantCert  string
+		wantKey   string
+	}{
+		{desc: "no flags", wantCert: "cert.pem", wantKey: "key.pem"},
+		{desc: "cert only", cert: "new.pem", wantCert: "new.pem", wantKey: "key.pem"},
+		{desc: "key only", key: "new-key.pem", wantCert: "cert.pem", wantKey: "new-key.pem"},
+		{desc: "both", cert: "new.pem", key: "new-key.pem", wantCert: "new.pem", wantKey: "new-key.pem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := overrideTLSFiles(cfg, tt.cert, tt.key)
+			assert.Equal(t, tt.wantCert, got.CertFile)
+			assert.Equal(t, tt.wantKey, got.KeyFile)
+			assert.Equal(t, "1.3", got.MinVersion)
+		})
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "first")
+
+	c, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	c.checkInterval = 0
+
+	commonName := func() string {
+		cert, err := c.GetCertificate(nil)
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+	assert.Equal(t, "first", commonName())
+
+	// Ensure modification times differ even on coarse-grained filesystems.
+	touch := func(name string, d time.Duration) {
+		future := time.Now().Add(d)
+		require.NoError(t, os.Chtimes(name, future, future))
+	}
+
+	writeTestCert(t, certFile, keyFile, "second")
+	touch(certFile, time.Minute)
+	touch(keyFile, time.Minute)
+	assert.Equal(t, "second", commonName())
+
+	// A broken certificate is ignored.
+	require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o644))
+	touch(certFile, 2*time.Minute)
+	assert.Equal(t, "second", commonName())
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		desc string
+		port string
+		host string
+		path string
+		want string
+	}{
+		{
+			desc: "default port",
+			port: "443",
+			host: "go.uber.org",
+			path: "/zap?go-get=1",
+			want: "https://go.uber.org/zap?go-get=1",
+		},
+		{
+			desc: "strips http port",
+			port: "",
+			host: "go.uber.org:80",
+			path: "/zap",
+			want: "https://go.uber.org/zap",
+		},
+		{
+			desc: "custom port",
+			port: "8443",
+			host: "go.uber.org:8080",
+			path: "/zap/zapcore",
+			want: "https://go.uber.org:8443/zap/zapcore",
+		},
+		{
+			desc: "ipv6",
+			port: "443",
+			host: "[::1]:80",
+			path: "/",
+			want: "https://[::1]/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Host = tt.host
+			rr := httptest.NewRecorder()
+			redirectToHTTPS(tt.port).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+			assert.Equal(t, tt.want, rr.Header().Get("Location"))
+		})
+	}
+}
+
+func TestTLSConfigValidation(t *testing.T) {
+	_, err := Parse(TempFile(t, `
+url: go.uber.org
+tls:
+  cert_file: cert.pem
+  min_version: "1.4"
+`))
+	require.Error(t, err)
+	assert.Equal(t, `3:1: tls.cert_file and tls.key_file must be specified together
+5:16: tls.min_version must be one of "1.0", "1.1", "1.2", or "1.3": "1.4"`, err.Error())
+}
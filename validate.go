@@ -0,0 +1,645 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ConfigError is a problem found in a configuration.
+type ConfigError struct {
+	// Line and Column hold the 1-based position of the problem
+	// in the configuration file, or zero if it's not known.
+	Line, Column int
+
+	// Msg describes the problem.
+	Msg string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%d:%d: %v", e.Line, e.Column, e.Msg)
+}
+
+// Validate checks the configuration for semantic problems,
+// such as missing required fields or malformed package names.
+// It reports all problems it finds as a joined list of [*ConfigError]s,
+// ordered by their position in the configuration file.
+func (c *Config) Validate() error {
+	var errs []*ConfigError
+	report := func(node *yaml.Node, format string, args ...interface{}) {
+		err := &ConfigError{Msg: fmt.Sprintf(format, args...)}
+		if node != nil {
+			err.Line, err.Column = node.Line, node.Column
+		}
+		errs = append(errs, err)
+	}
+
+	if c.source != nil && !c.AllowUnknownKeys {
+		checkKnownKeys(c.source, reflect.TypeOf(c).Elem(), "", report)
+	}
+
+	_, urlNode := c.lookup("url")
+	switch {
+	case c.URL == "":
+		report(urlNode, "url is required")
+	case strings.Contains(c.URL, "://"):
+		report(urlNode, "url must not include a scheme: %q", c.URL)
+	}
+
+	for _, setting := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"read_timeout", c.Server.ReadTimeout},
+		{"write_timeout", c.Server.WriteTimeout},
+		{"idle_timeout", c.Server.IdleTimeout},
+		{"shutdown_timeout", c.Server.ShutdownTimeout},
+	} {
+		if setting.value < 0 {
+			_, node := c.lookup("server", setting.key)
+			report(node, "server.%v must not be negative: %v", setting.key, setting.value)
+		}
+	}
+	if c.Server.MaxHeaderBytes < 0 {
+		_, node := c.lookup("server", "max_header_bytes")
+		report(node, "server.max_header_bytes must not be negative: %v", c.Server.MaxHeaderBytes)
+	}
+
+	_, listeners := c.lookup("listeners")
+	for i, ln := range c.Listeners {
+		if err := validateListener(ln); err != nil {
+			report(sequenceItem(listeners, i), "listeners[%d]: %v", i, err)
+		}
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		key, _ := c.lookup("tls")
+		report(key, "tls.cert_file and tls.key_file must be specified together")
+	}
+	if v := c.TLS.MinVersion; v != "" {
+		if _, ok := _tlsVersions[v]; !ok {
+			_, node := c.lookup("tls", "min_version")
+			report(node, `tls.min_version must be one of "1.0", "1.1", "1.2", or "1.3": %q`, v)
+		}
+	}
+
+	switch c.AccessLog.Format {
+	case "", "text", "json":
+	default:
+		_, node := c.lookup("access_log", "format")
+		report(node, `access_log.format must be "text" or "json": %q`, c.AccessLog.Format)
+	}
+	if r := c.AccessLog.SampleRate; r < 0 || r > 1 {
+		_, node := c.lookup("access_log", "sample_rate")
+		report(node, "access_log.sample_rate must be between 0 and 1: %v", r)
+	}
+	_, proxies := c.lookup("access_log", "trusted_proxies")
+	for i, proxy := range c.AccessLog.TrustedProxies {
+		if _, err := parsePrefix(proxy); err != nil {
+			report(sequenceItem(proxies, i), "access_log.trusted_proxies: %v", err)
+		}
+	}
+
+	if err := validateBrowserRedirect(c.BrowserRedirect); err != nil {
+		_, node := c.lookup("browser_redirect")
+		report(node, "browser_redirect %v", err)
+	}
+
+	for _, setting := range []struct{ key, value string }{
+		{"index", c.CacheControl.Index},
+		{"package", c.CacheControl.Package},
+		{"go_get", c.CacheControl.GoGet},
+	} {
+		if !httpguts.ValidHeaderFieldValue(setting.value) {
+			_, node := c.lookup("cache_control", setting.key)
+			report(node, "cache_control.%v is not a valid header value: %q", setting.key, setting.value)
+		}
+	}
+
+	// Paths served by sally itself, keyed by their configuration key.
+	// These must not overlap with package names.
+	adminPaths := make(map[string]string)
+	for _, ep := range []struct{ key, path string }{
+		{"health_path", c.Admin.HealthPath},
+		{"ready_path", c.Admin.ReadyPath},
+		{"version_path", c.Admin.VersionPath},
+		{"metrics_path", c.Admin.MetricsPath},
+	} {
+		if ep.path == "" {
+			continue
+		}
+
+		_, node := c.lookup("admin", ep.key)
+		if !strings.HasPrefix(ep.path, "/") || ep.path == "/" {
+			report(node, "admin.%v must be an absolute path other than '/': %q", ep.key, ep.path)
+			continue
+		}
+		adminPaths["admin."+ep.key] = strings.Trim(ep.path, "/")
+	}
+
+	// Names of packages keyed by their normalized form.
+	// Used to detect overlapping package names.
+	seen := make(map[string]string)
+	for _, name := range sortedKeys(c.Packages) {
+		pkg := c.Packages[name]
+		nameNode, _ := c.lookup("packages", name)
+
+		if isPattern(name) {
+			c.validatePattern(name, pkg, report)
+		} else if err := validateRelPath(name); err != nil {
+			report(nameNode, "package %q: name %v", name, err)
+		}
+		if reserved := strings.TrimPrefix(_apiPackagesPath, "/"); descends(reserved, name) {
+			report(nameNode, "package %q: name conflicts with the JSON API at %v", name, _apiPackagesPath)
+		}
+		for _, key := range sortedKeys(adminPaths) {
+			if p := adminPaths[key]; descends(p, name) || descends(name, p) {
+				report(nameNode, "package %q: name conflicts with %v %q", name, key, "/"+p)
+			}
+		}
+
+		key := path.Clean(strings.Trim(name, "/"))
+		if other, ok := seen[key]; ok {
+			report(nameNode, "package %q overlaps with package %q", name, other)
+		} else {
+			seen[key] = name
+		}
+
+		_, repoNode := c.lookup("packages", name, "repo")
+		if pkg.Repo == "" {
+			report(nameNode, "package %q: repo is required", name)
+		}
+
+		// An empty VCS is the default if the configuration wasn't parsed.
+		pkg.VCS = cmp.Or(pkg.VCS, "git")
+		pkg.Origin.VCS = cmp.Or(pkg.Origin.VCS, "git")
+
+		_, vcsNode := c.lookup("packages", name, "vcs")
+		if _, ok := _vcsKinds[pkg.VCS]; !ok {
+			report(vcsNode, "package %q: vcs must be one of %v: %q", name, vcsNames(), pkg.VCS)
+		} else if pkg.Repo != "" {
+			if err := validateRepo(pkg.VCS, withoutPlaceholders(pkg.Repo)); err != nil {
+				report(repoNode, "package %q: %v", name, err)
+			}
+		}
+		c.validateOrigin(name, pkg, report)
+
+		if pkg.Subdir != "" {
+			_, node := c.lookup("packages", name, "subdir")
+			if err := validateRelPath(pkg.Subdir); err != nil {
+				report(node, "package %q: subdir %v", name, err)
+			} else if pkg.VCS == _vcsMod && pkg.Origin.Repo == "" {
+				// Module proxies serve modules from their own paths.
+				report(node, "package %q: subdir requires origin when vcs is %q", name, _vcsMod)
+			}
+		}
+
+		if strings.Contains(pkg.URL, "://") {
+			_, node := c.lookup("packages", name, "url")
+			report(node, "package %q: url must not include a scheme: %q", name, pkg.URL)
+		}
+
+		for _, link := range []struct{ key, value string }{
+			{"browse_url", pkg.BrowseURL},
+			{"homepage", pkg.Homepage},
+			{"issues_url", pkg.IssuesURL},
+		} {
+			if link.value == "" {
+				continue
+			}
+			if err := validateWebURL(withoutPlaceholders(link.value)); err != nil {
+				_, node := c.lookup("packages", name, link.key)
+				report(node, "package %q: %v %v", name, link.key, err)
+			}
+		}
+
+		if err := validateBrowserRedirect(withoutPlaceholders(pkg.BrowserRedirect)); err != nil {
+			_, node := c.lookup("packages", name, "browser_redirect")
+			report(node, "package %q: browser_redirect %v", name, err)
+		}
+
+		if pkg.MovedTo != "" {
+			_, node := c.lookup("packages", name, "moved_to")
+			switch {
+			case strings.Contains(pkg.MovedTo, "://"):
+				report(node, "package %q: moved_to must not include a scheme: %q", name, pkg.MovedTo)
+			case strings.Trim(pkg.MovedTo, "/") == path.Join(cmp.Or(pkg.URL, c.URL), name):
+				report(node, "package %q: moved_to must not be the package's own module path", name)
+			}
+		}
+
+		switch pkg.Status {
+		case "":
+			for _, field := range []struct{ key, value string }{
+				{"status_message", pkg.StatusMessage},
+				{"replacement", pkg.Replacement},
+			} {
+				if field.value != "" {
+					key, _ := c.lookup("packages", name, field.key)
+					report(key, "package %q: %v requires status to be set", name, field.key)
+				}
+			}
+		case _statusDeprecated, _statusArchived:
+		default:
+			_, node := c.lookup("packages", name, "status")
+			report(node, "package %q: status must be %q or %q: %q",
+				name, _statusDeprecated, _statusArchived, pkg.Status)
+		}
+		if strings.Contains(pkg.Replacement, "://") {
+			_, node := c.lookup("packages", name, "replacement")
+			report(node, "package %q: replacement must not include a scheme: %q", name, pkg.Replacement)
+		}
+	}
+
+	// Packages served from subdirectories of the same repository
+	// must not claim the same or nested directories.
+	bySubdir := make(map[string][]string) // repoKey => names
+	for _, name := range sortedKeys(c.Packages) {
+		if pkg := c.Packages[name]; pkg.Subdir != "" && !isPattern(name) {
+			key := repoKey(pkg.Repo)
+			bySubdir[key] = append(bySubdir[key], name)
+		}
+	}
+	for _, key := range sortedKeys(bySubdir) {
+		names := bySubdir[key]
+		for i, name := range names {
+			for _, other := range names[:i] {
+				a, b := c.Packages[other].Subdir, c.Packages[name].Subdir
+				if descends(a, b) || descends(b, a) {
+					_, node := c.lookup("packages", name, "subdir")
+					report(node, "package %q: subdir %q overlaps with subdir %q of package %q in %v",
+						name, b, a, other, c.Packages[name].Repo)
+				}
+			}
+		}
+	}
+
+	slices.SortStableFunc(errs, func(a, b *ConfigError) int {
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+
+	joined := make([]error, len(errs))
+	for i, err := range errs {
+		joined[i] = err
+	}
+	return errors.Join(joined...)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// validatePattern checks that a pattern entry in the packages map compiles
+// and that its fields refer only to placeholders the pattern provides.
+func (c *Config) validatePattern(
+	name string,
+	pkg PackageConfig,
+	report func(*yaml.Node, string, ...interface{}),
+) {
+	re, err := compilePattern(name)
+	if err != nil {
+		nameNode, _ := c.lookup("packages", name)
+		report(nameNode, "package %q: %v", name, err)
+		return
+	}
+	if !isRegexpPattern(name) {
+		// Globs must be valid package names with '*' in place of names.
+		if err := validateRelPath(strings.ReplaceAll(name, "*", "x")); err != nil {
+			nameNode, _ := c.lookup("packages", name)
+			report(nameNode, "package %q: name %v", name, err)
+		}
+	}
+
+	for _, field := range []struct{ key, value string }{
+		{"repo", pkg.Repo},
+		{"subdir", pkg.Subdir},
+		{"url", pkg.URL},
+		{"description", pkg.Desc},
+		{"browse_url", pkg.BrowseURL},
+		{"homepage", pkg.Homepage},
+		{"issues_url", pkg.IssuesURL},
+		{"doc_url", pkg.DocURL},
+		{"doc_badge", pkg.DocBadge},
+		{"moved_to", pkg.MovedTo},
+		{"browser_redirect", pkg.BrowserRedirect},
+		{"status_message", pkg.StatusMessage},
+		{"replacement", pkg.Replacement},
+	} {
+		if err := checkPlaceholders(re, field.value); err != nil {
+			_, node := c.lookup("packages", name, field.key)
+			report(node, "package %q: %v: %v", name, field.key, err)
+		}
+	}
+	if err := checkPlaceholders(re, pkg.Origin.Repo); err != nil {
+		_, node := c.lookup("packages", name, "origin", "repo")
+		report(node, "package %q: origin.repo: %v", name, err)
+	}
+}
+
+// validateOrigin checks the origin repository of a package,
+// which is only allowed for packages served from a module proxy.
+func (c *Config) validateOrigin(
+	name string,
+	pkg PackageConfig,
+	report func(*yaml.Node, string, ...interface{}),
+) {
+	if pkg.Origin.Repo == "" && !c.hasKey("packages", name, "origin") {
+		return
+	}
+
+	key, _ := c.lookup("packages", name, "origin")
+	_, vcsNode := c.lookup("packages", name, "origin", "vcs")
+	_, repoNode := c.lookup("packages", name, "origin", "repo")
+	_, known := _vcsKinds[pkg.Origin.VCS]
+	switch {
+	case pkg.VCS != _vcsMod:
+		report(key, "package %q: origin requires vcs to be %q", name, _vcsMod)
+	case pkg.Origin.Repo == "":
+		report(key, "package %q: origin.repo is required", name)
+	case !known || pkg.Origin.VCS == _vcsMod:
+		report(vcsNode, "package %q: origin.vcs must be a version control system other than %q: %q",
+			name, _vcsMod, pkg.Origin.VCS)
+	default:
+		if err := validateRepo(pkg.Origin.VCS, withoutPlaceholders(pkg.Origin.Repo)); err != nil {
+			report(repoNode, "package %q: origin.repo: %v", name, err)
+		}
+	}
+}
+
+// validateBrowserRedirect checks a browser_redirect setting,
+// which may be empty to use the default.
+func validateBrowserRedirect(s string) error {
+	switch s {
+	case "", _redirectDocs, _redirectRepo, _redirectNone:
+		return nil
+	}
+	if err := validateWebURL(s); err != nil {
+		return fmt.Errorf(`must be "docs", "repo", "none", or an absolute http or https URL: %q`, s)
+	}
+	return nil
+}
+
+// validateWebURL checks that s is an absolute http or https URL.
+func validateWebURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an absolute http or https URL: %q", s)
+	}
+	return nil
+}
+
+// validateListener checks that a listener configuration is well-formed.
+func validateListener(ln ListenerConfig) error {
+	if ln.Addr == "" {
+		return errors.New("addr is required")
+	}
+
+	if ln.AdminOnly && ln.NoAdmin {
+		return errors.New("admin_only and no_admin are mutually exclusive")
+	}
+
+	isUnix := strings.HasPrefix(ln.Addr, _unixPrefix)
+	if (ln.Mode != "" || ln.Owner != "") && !isUnix {
+		return errors.New("mode and owner apply only to unix sockets")
+	}
+	if ln.Mode != "" {
+		if _, err := parseFileMode(ln.Mode); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case isUnix:
+		if strings.TrimPrefix(ln.Addr, _unixPrefix) == "" {
+			return errors.New("unix socket path is required")
+		}
+	case strings.HasPrefix(ln.Addr, _systemdPrefix):
+		if strings.TrimPrefix(ln.Addr, _systemdPrefix) == "" {
+			return errors.New("systemd socket name is required")
+		}
+	default:
+		if _, _, err := net.SplitHostPort(ln.Addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRelPath checks that p is a clean, relative,
+// slash-separated path.
+func validateRelPath(p string) error {
+	if p == "" {
+		return errors.New("must not be empty")
+	}
+	if strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") {
+		return errors.New("must not start or end with '/'")
+	}
+	for _, part := range strings.Split(p, "/") {
+		switch part {
+		case "":
+			return errors.New("must not contain empty path components")
+		case ".", "..":
+			return fmt.Errorf("must not contain %q path components", part)
+		}
+	}
+	return nil
+}
+
+// checkKnownKeys reports keys in the given YAML node
+// that don't correspond to a field in the type t it will be decoded into.
+// where is the dot-separated path to node used in error messages.
+//
+// Fields tagged ",inline" are not supported;
+// the configuration types don't use them.
+func checkKnownKeys(
+	node *yaml.Node,
+	t reflect.Type,
+	where string,
+	report func(*yaml.Node, string, ...interface{}),
+) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			checkKnownKeys(n, t, where, report)
+		}
+		return
+	case yaml.AliasNode:
+		checkKnownKeys(node.Alias, t, where, report)
+		return
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()) {
+		// Types with custom decoding define their own keys.
+		return
+	}
+
+	join := func(key string) string {
+		if where == "" {
+			return key
+		}
+		return where + "." + key
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			fields[name] = f.Type
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				// Merge keys are checked by the mapping they refer to.
+				continue
+			}
+
+			ft, ok := fields[key.Value]
+			if !ok {
+				if where == "" {
+					report(key, "unknown key %q", key.Value)
+				} else {
+					report(key, "unknown key %q in %q", key.Value, where)
+				}
+				continue
+			}
+			checkKnownKeys(value, ft, join(key.Value), report)
+		}
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			checkKnownKeys(value, t.Elem(), join(key.Value), report)
+		}
+
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			checkKnownKeys(item, t.Elem(), join(strconv.Itoa(i)), report)
+		}
+	}
+}
+
+// hasKey reports whether the source document has the given key.
+func (c *Config) hasKey(keys ...string) bool {
+	key, _ := c.lookup(keys...)
+	return key != nil
+}
+
+// lookup finds the key and value nodes at the given sequence of mapping keys
+// in the source document. It returns nil nodes if the configuration
+// wasn't parsed from a file or if the path doesn't exist.
+func (c *Config) lookup(keys ...string) (key, value *yaml.Node) {
+	if c.source == nil {
+		return nil, nil
+	}
+
+	value = c.source
+	if value.Kind == yaml.DocumentNode && len(value.Content) > 0 {
+		value = value.Content[0]
+	}
+
+	for _, name := range keys {
+		if value.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+
+		var found bool
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			if value.Content[i].Value == name {
+				key, value = value.Content[i], value.Content[i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil
+		}
+	}
+	return key, value
+}
+
+// sequenceItem returns the i-th item of a YAML sequence node,
+// or nil if node is not a sequence or doesn't have that many items.
+func sequenceItem(node *yaml.Node, i int) *yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+		return nil
+	}
+	return node.Content[i]
+}
+
+// runValidate implements the "validate" subcommand.
+// It parses and validates a configuration file,
+// reporting every problem found to stderr.
+// It returns the exit code for the process.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("sally validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	yml := flags.String("yml", "sally.yaml", "yaml file to validate")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	config, err := Parse(*yml)
+	if err != nil {
+		// Report each validation problem on its own line.
+		errs := []error{err}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = joined.Unwrap()
+		}
+		for _, err := range errs {
+			var cerr *ConfigError
+			if errors.As(err, &cerr) && cerr.Line > 0 {
+				fmt.Fprintf(stderr, "%v:%d:%d: %v\n", *yml, cerr.Line, cerr.Column, cerr.Msg)
+			} else {
+				fmt.Fprintf(stderr, "%v: %v\n", *yml, err)
+			}
+		}
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%v: OK (%d packages)\n", *yml, len(config.Packages))
+	return 0
+}
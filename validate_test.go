@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		desc string
+		give string
+		want []string // errors, in order
+	}{
+		{
+			desc: "valid",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+  zap/exp:
+    repo: github.com/uber-go/zap
+`,
+		},
+		{
+			desc: "missing url",
+			give: `
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+`,
+			want: []string{"url is required"},
+		},
+		{
+			desc: "url with scheme",
+			give: `
+url: https://go.uber.org
+`,
+			want: []string{`2:6: url must not include a scheme: "https://go.uber.org"`},
+		},
+		{
+			desc: "missing repo",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    description: A fast, structured logging library.
+`,
+			want: []string{`4:3: package "zap": repo is required`},
+		},
+		{
+			desc: "repo with scheme",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    repo: https://github.com/uber-go/zap
+  yarpc:
+    repo: ssh://git@github.com/yarpc/yarpc-go.git
+  multierr:
+    repo: svn+ssh://svn.example.com/multierr
+    vcs: svn
+`,
+		},
+		{
+			desc: "repo with unsupported scheme",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    repo: ftp://github.com/uber-go/zap
+  multierr:
+    repo: svn+ssh://svn.example.com/multierr
+`,
+			want: []string{
+				`5:11: package "zap": scheme "ftp" is not supported for git repositories`,
+				`7:11: package "multierr": scheme "svn+ssh" is not supported for git repositories`,
+			},
+		},
+		{
+			desc: "package url with scheme",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+    url: http://go.uberalt.org
+`,
+			want: []string{
+				`6:10: package "zap": url must not include a scheme: "http://go.uberalt.org"`,
+			},
+		},
+		{
+			desc: "bad names",
+			give: `
+url: go.uber.org
+packages:
+  /zap:
+    repo: github.com/uber-go/zap
+  ../yarpc:
+    repo: github.com/yarpc/yarpc-go
+  net//metrics:
+    repo: github.com/yarpc/metrics
+`,
+			want: []string{
+				`4:3: package "/zap": name must not start or end with '/'`,
+				`6:3: package "../yarpc": name must not contain ".." path components`,
+				`8:3: package "net//metrics": name must not contain empty path components`,
+			},
+		},
+		{
+			desc: "overlapping names",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+  zap/:
+    repo: github.com/uber-go/zap
+`,
+			want: []string{
+				`6:3: package "zap/": name must not start or end with '/'`,
+				`6:3: package "zap/" overlaps with package "zap"`,
+			},
+		},
+		{
+			desc: "subdirs",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+  zap/exp:
+    repo: github.com/uber-go/zap
+    subdir: exp
+  zap/exp/more:
+    repo: github.com/uber-go/zap
+    subdir: exp/more
+  zap/tools:
+    repo: github.com/uber-go/zap
+    subdir: tools
+  zap/tools2:
+    repo: github.com/uber-go/zap
+    subdir: tools
+  atomic/tools:
+    repo: github.com/uber-go/atomic
+    subdir: tools
+  bad:
+    repo: github.com/uber-go/bad
+    subdir: ../bad
+`,
+			want: []string{
+				`11:13: package "zap/exp/more": subdir "exp/more" overlaps with subdir "exp" of package "zap/exp" in github.com/uber-go/zap`,
+				`17:13: package "zap/tools2": subdir "tools" overlaps with subdir "tools" of package "zap/tools" in github.com/uber-go/zap`,
+				`23:13: package "bad": subdir must not contain ".." path components`,
+			},
+		},
+		{
+			desc: "subdir overlap in differently written repos",
+			give: `
+url: go.uber.org
+packages:
+  zap/exp:
+    repo: github.com/uber-go/zap
+    subdir: exp
+  zap/exp2:
+    repo: https://github.com/uber-go/zap
+    subdir: exp
+  zap/exp3:
+    repo: https://github.com/uber-go/zap.git/
+    subdir: exp/more
+  zap/tools:
+    repo: https://github.com/uber-go/zap-tools
+    subdir: exp
+`,
+			want: []string{
+				`9:13: package "zap/exp2": subdir "exp" overlaps with subdir "exp" of package "zap/exp" in https://github.com/uber-go/zap`,
+				`12:13: package "zap/exp3": subdir "exp/more" overlaps with subdir "exp" of package "zap/exp" in https://github.com/uber-go/zap.git/`,
+				`12:13: package "zap/exp3": subdir "exp/more" overlaps with subdir "exp" of package "zap/exp2" in https://github.com/uber-go/zap.git/`,
+			},
+		},
+		{
+			desc: "multiple problems",
+			give: `
+packages:
+  zap:
+    repo: ftp://github.com/uber-go/zap
+  yarpc: {}
+`,
+			want: []string{
+				"url is required",
+				`4:11: package "zap": scheme "ftp" is not supported for git repositories`,
+				`5:3: package "yarpc": repo is required`,
+			},
+		},
+		{
+			desc: "invalid moved_to",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+    moved_to: https://go.uber.org/zap/v2
+  yarpc:
+    repo: github.com/yarpc/yarpc-go
+    moved_to: go.uber.org/yarpc
+`,
+			want: []string{
+				`6:15: package "zap": moved_to must not include a scheme: "https://go.uber.org/zap/v2"`,
+				`9:15: package "yarpc": moved_to must not be the package's own module path`,
+			},
+		},
+		{
+			desc: "invalid status",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+    status: retired
+  yarpc:
+    repo: github.com/yarpc/yarpc-go
+    status_message: Use gRPC.
+    replacement: https://google.golang.org/grpc
+`,
+			want: []string{
+				`6:13: package "zap": status must be "deprecated" or "archived": "retired"`,
+				`9:5: package "yarpc": status_message requires status to be set`,
+				`10:5: package "yarpc": replacement requires status to be set`,
+				`10:18: package "yarpc": replacement must not include a scheme: "https://google.golang.org/grpc"`,
+			},
+		},
+		{
+			desc: "valid vcs",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    repo: hg.example.com/zap
+    vcs: hg
+  multierr:
+    repo: proxy.example.com
+    vcs: mod
+    origin:
+      repo: github.com/uber-go/multierr
+`,
+		},
+		{
+			desc: "invalid vcs",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+    vcs: cvs
+  yarpc:
+    repo: github.com/yarpc/yarpc-go
+    vcs: hg
+  atomic:
+    repo: github.com/uber-go/atomic
+    origin:
+      repo: github.com/uber-go/atomic
+  multierr:
+    repo: proxy.example.com
+    vcs: mod
+    origin:
+      vcs: mod
+      repo: proxy.example.com
+  fx:
+    repo: proxy.example.com
+    vcs: mod
+    subdir: fx
+    origin:
+      vcs: git
+`,
+			want: []string{
+				`6:10: package "zap": vcs must be one of "bzr", "fossil", "git", "hg", "mod", or "svn": "cvs"`,
+				`8:11: package "yarpc": github.com hosts only git repositories`,
+				`12:5: package "atomic": origin requires vcs to be "mod"`,
+				`18:12: package "multierr": origin.vcs must be a version control system other than "mod": "mod"`,
+				`23:13: package "fx": subdir requires origin when vcs is "mod"`,
+				`24:5: package "fx": origin.repo is required`,
+			},
+		},
+		{
+			desc: "invalid links",
+			give: `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+    browse_url: github.com/uber-go/zap
+    homepage: /zap
+    issues_url: mailto:zap@example.com
+`,
+			want: []string{
+				`6:17: package "zap": browse_url must be an absolute http or https URL: "github.com/uber-go/zap"`,
+				`7:15: package "zap": homepage must be an absolute http or https URL: "/zap"`,
+				`8:17: package "zap": issues_url must be an absolute http or https URL: "mailto:zap@example.com"`,
+			},
+		},
+		{
+			desc: "invalid browser_redirect",
+			give: `
+url: go.uber.org
+browser_redirect: godoc
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+    browser_redirect: zap.example.com
+`,
+			want: []string{
+				`3:19: browser_redirect must be "docs", "repo", "none", or an absolute http or https URL: "godoc"`,
+				`7:23: package "zap": browser_redirect must be "docs", "repo", "none", ` +
+					`or an absolute http or https URL: "zap.example.com"`,
+			},
+		},
+		{
+			desc: "invalid cache_control",
+			give: `
+url: go.uber.org
+cache_control:
+  index: public, max-age=60
+  go_get: "max-age=60\r\nSet-Cookie: x=y"
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+`,
+			want: []string{
+				`5:11: cache_control.go_get is not a valid header value: "max-age=60\r\nSet-Cookie: x=y"`,
+			},
+		},
+		{
+			desc: "valid patterns",
+			give: `
+url: go.uber.org
+packages:
+  "*":
+    repo: github.com/uber-go/{name}
+  "contrib/*-go":
+    repo: github.com/uber-contrib/{1}
+  "^(?P<lang>go|rust)-(\\w+)$":
+    repo: github.com/uber-{lang}/{2}
+    description: "{name} for {lang}"
+`,
+		},
+		{
+			desc: "invalid patterns",
+			give: `
+url: go.uber.org
+packages:
+  "^foo(":
+    repo: github.com/uber-go/foo
+  "*/":
+    repo: github.com/uber-go/{name}
+  "contrib/*":
+    repo: github.com/uber-contrib/{2}
+    doc_url: https://example.com/{owner}
+  "^(?P<lang>go|rust)$":
+    subdir: "{lang}"
+`,
+			want: []string{
+				`4:3: package "^foo(": error parsing regexp: missing closing ): ` + "`^foo(`",
+				`6:3: package "*/": name must not start or end with '/'`,
+				`9:11: package "contrib/*": repo: unknown placeholder {2}`,
+				`10:14: package "contrib/*": doc_url: unknown placeholder {owner}`,
+				`11:3: package "^(?P<lang>go|rust)$": repo is required`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := Parse(TempFile(t, tt.give))
+			if len(tt.want) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, strings.Join(tt.want, "\n"), err.Error())
+
+			var cerr *ConfigError
+			assert.ErrorAs(t, err, &cerr)
+		})
+	}
+}
+
+func TestValidateWithoutSource(t *testing.T) {
+	c := Config{
+		URL: "go.uber.org",
+		Packages: map[string]PackageConfig{
+			"zap": {},
+		},
+	}
+	assert.EqualError(t, c.Validate(), `package "zap": repo is required`)
+}
+
+func TestRunValidate(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		path := TempFile(t, `
+url: go.uber.org
+packages:
+  zap:
+    repo: github.com/uber-go/zap
+`)
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, runValidate([]string{"-yml", path}, &stdout, &stderr))
+		assert.Equal(t, path+": OK (1 packages)\n", stdout.String())
+		assert.Empty(t, stderr.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		path := TempFile(t, `
+packages:
+  zap:
+    repo: ftp://github.com/uber-go/zap
+`)
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 1, runValidate([]string{"-yml", path}, &stdout, &stderr))
+		assert.Empty(t, stdout.String())
+		assert.Equal(t,
+			path+": url is required\n"+
+				path+`:4:11: package "zap": scheme "ftp" is not supported for git repositories`+"\n",
+			stderr.String())
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 1, runValidate([]string{"-yml", "does-not-exist.yaml"}, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), "does-not-exist.yaml")
+	})
+
+	t.Run("bad flags", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, runValidate([]string{"-unknown"}, &stdout, &stderr))
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// _vcsMod is the VCS value for modules served by a module proxy
+// rather than a version control repository.
+const _vcsMod = "mod"
+
+// vcsKind describes a value accepted for PackageConfig.VCS.
+type vcsKind struct {
+	// Schemes the go command accepts for repository URLs of this kind.
+	schemes []string
+}
+
+// _vcsKinds lists the version control systems understood by the go command.
+// See cmd/go/internal/vcs.
+var _vcsKinds = map[string]vcsKind{
+	"git":    {schemes: []string{"https", "http", "git", "git+ssh", "ssh"}},
+	"hg":     {schemes: []string{"https", "http", "ssh"}},
+	"svn":    {schemes: []string{"https", "http", "svn", "svn+ssh"}},
+	"fossil": {schemes: []string{"https", "http"}},
+	_vcsMod:  {schemes: []string{"https", "http"}},
+
+	// Bazaar support was removed from the go command in Go 1.22,
+	// but older versions still understand it.
+	"bzr": {schemes: []string{"https", "http", "bzr", "bzr+ssh"}},
+}
+
+// vcsNames returns a human-readable list of the accepted VCS values.
+func vcsNames() string {
+	names := sortedKeys(_vcsKinds)
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%q", name)
+	}
+	return strings.Join(names[:len(names)-1], ", ") + ", or " + names[len(names)-1]
+}
+
+// vcsHost is a well-known hosting site
+// whose repositories the go command resolves without go-import metadata.
+type vcsHost struct {
+	vcs string
+
+	// root matches the repository root of a valid repository URL,
+	// excluding the scheme.
+	root *regexp.Regexp
+}
+
+// _vcsHosts lists hosting sites that serve a single kind of repository.
+// See vcsPaths in cmd/go/internal/vcs.
+var _vcsHosts = map[string]vcsHost{
+	"github.com": {
+		vcs:  "git",
+		root: regexp.MustCompile(`^github\.com/[\w.\-]+/[\w.\-]+$`),
+	},
+	"bitbucket.org": {
+		vcs:  "git",
+		root: regexp.MustCompile(`^bitbucket\.org/[\w.\-]+/[\w.\-]+$`),
+	},
+	"chiselapp.com": {
+		vcs:  "fossil",
+		root: regexp.MustCompile(`^chiselapp\.com/user/[A-Za-z0-9]+/repository/[\w.\-]+$`),
+	},
+}
+
+// repoRoot returns the repository URL served to the go command for repo,
+// adding the https scheme if repo doesn't have one.
+func repoRoot(repo string) string {
+	if strings.Contains(repo, "://") {
+		return repo
+	}
+	return "https://" + repo
+}
+
+// repoKey returns a key that identifies the repository at repo,
+// so that URLs written with and without a scheme, a trailing slash,
+// or a .git suffix are treated as the same repository.
+func repoKey(repo string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(repoRoot(repo), "/"), ".git")
+}
+
+// _forgeIssuesPaths maps well-known code hosting sites
+// to the path of a repository's issue tracker relative to the repository.
+var _forgeIssuesPaths = map[string]string{
+	"github.com":    "/issues",
+	"gitlab.com":    "/-/issues",
+	"bitbucket.org": "/issues",
+	"codeberg.org":  "/issues",
+}
+
+// browseURL returns a URL at which repo can likely be viewed in a browser.
+//
+// Repositories on well-known hosting sites are viewed
+// at their canonical https URL without a .git suffix.
+// Other repositories served over http or https are viewed at the same URL.
+// For other schemes, like ssh, this assumes that the host
+// serves a web interface over https at the same path.
+func browseURL(repo string) string {
+	root := repoRoot(repo)
+	u, err := url.Parse(root)
+	if err != nil {
+		return root
+	}
+	if _, ok := _forgeIssuesPaths[u.Hostname()]; !ok {
+		switch u.Scheme {
+		case "http", "https":
+			return root
+		}
+	}
+	return (&url.URL{
+		Scheme: "https",
+		Host:   u.Hostname(),
+		Path:   strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git"),
+	}).String()
+}
+
+// issuesURL returns the URL of the issue tracker for repo
+// if it's hosted on a well-known hosting site, or an empty string otherwise.
+func issuesURL(repo string) string {
+	u, err := url.Parse(repoRoot(repo))
+	if err != nil {
+		return ""
+	}
+	issuesPath, ok := _forgeIssuesPaths[u.Hostname()]
+	if !ok {
+		return ""
+	}
+	return browseURL(repo) + issuesPath
+}
+
+// validateRepo checks that repo is a plausible repository URL
+// for the given VCS.
+// Repository URLs without a scheme are assumed to use https.
+//
+// vcs must be a key of _vcsKinds.
+func validateRepo(vcs, repo string) error {
+	kind := _vcsKinds[vcs]
+
+	scheme, rest, ok := strings.Cut(repo, "://")
+	if !ok {
+		scheme, rest = "https", repo
+	}
+	if !slices.Contains(kind.schemes, scheme) {
+		return fmt.Errorf("scheme %q is not supported for %v repositories", scheme, vcs)
+	}
+
+	u, err := url.Parse(scheme + "://" + rest)
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.Host == "":
+		return fmt.Errorf("%q has no host", repo)
+	case u.RawQuery != "" || u.Fragment != "" || strings.ContainsAny(rest, "?# \t"):
+		return fmt.Errorf("%q must not contain a query, fragment, or whitespace", repo)
+	}
+
+	if vcs == _vcsMod {
+		// Module proxies may be served from any URL.
+		return nil
+	}
+
+	if host, ok := _vcsHosts[u.Hostname()]; ok {
+		if host.vcs != vcs {
+			return fmt.Errorf("%v hosts only %v repositories", u.Hostname(), host.vcs)
+		}
+		root := strings.TrimSuffix(u.Hostname()+u.Path, "/")
+		if !host.root.MatchString(root) {
+			return fmt.Errorf("%q is not a repository root on %v", repo, u.Hostname())
+		}
+	}
+	return nil
+}
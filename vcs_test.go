@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRepo(t *testing.T) {
+	tests := []struct {
+		vcs     string
+		repo    string
+		wantErr string
+	}{
+		{vcs: "git", repo: "github.com/uber-go/zap"},
+		{vcs: "git", repo: "github.com/uber-go/zap.git"},
+		{vcs: "git", repo: "git.example.com/zap"},
+		{vcs: "git", repo: "ssh://git@github.com/uber-go/zap"},
+		{vcs: "hg", repo: "hg.example.com/zap"},
+		{vcs: "svn", repo: "svn://svn.example.com/zap/trunk"},
+		{vcs: "fossil", repo: "chiselapp.com/user/uber/repository/zap"},
+		{vcs: "bzr", repo: "bzr+ssh://bzr.example.com/zap"},
+		{vcs: "mod", repo: "proxy.example.com"},
+		{vcs: "mod", repo: "github.com/uber-go"},
+		{
+			vcs:     "hg",
+			repo:    "github.com/uber-go/zap",
+			wantErr: "github.com hosts only git repositories",
+		},
+		{
+			vcs:     "git",
+			repo:    "github.com/uber-go",
+			wantErr: `"github.com/uber-go" is not a repository root on github.com`,
+		},
+		{
+			vcs:     "git",
+			repo:    "github.com/uber-go/zap/zapcore",
+			wantErr: `"github.com/uber-go/zap/zapcore" is not a repository root on github.com`,
+		},
+		{
+			vcs:     "fossil",
+			repo:    "ssh://fossil.example.com/zap",
+			wantErr: `scheme "ssh" is not supported for fossil repositories`,
+		},
+		{
+			vcs:     "mod",
+			repo:    "git://proxy.example.com",
+			wantErr: `scheme "git" is not supported for mod repositories`,
+		},
+		{
+			vcs:     "git",
+			repo:    "/uber-go/zap",
+			wantErr: `"/uber-go/zap" has no host`,
+		},
+		{
+			vcs:     "git",
+			repo:    "git.example.com/zap?ref=main",
+			wantErr: "must not contain a query, fragment, or whitespace",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.vcs+" "+tt.repo, func(t *testing.T) {
+			err := validateRepo(tt.vcs, tt.repo)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRepoURLs(t *testing.T) {
+	tests := []struct {
+		repo       string
+		wantRoot   string
+		wantBrowse string
+	}{
+		{
+			repo:       "github.com/uber-go/zap",
+			wantRoot:   "https://github.com/uber-go/zap",
+			wantBrowse: "https://github.com/uber-go/zap",
+		},
+		{
+			repo:       "http://git.internal/zap",
+			wantRoot:   "http://git.internal/zap",
+			wantBrowse: "http://git.internal/zap",
+		},
+		{
+			repo:       "ssh://git@github.com:22/uber-go/zap.git",
+			wantRoot:   "ssh://git@github.com:22/uber-go/zap.git",
+			wantBrowse: "https://github.com/uber-go/zap",
+		},
+		{
+			repo:       "https://gitlab.com/uber/zap.git",
+			wantRoot:   "https://gitlab.com/uber/zap.git",
+			wantBrowse: "https://gitlab.com/uber/zap",
+		},
+		{
+			repo:       "https://git.example.com/zap.git",
+			wantRoot:   "https://git.example.com/zap.git",
+			wantBrowse: "https://git.example.com/zap.git",
+		},
+		{
+			repo:       "svn://svn.example.com/zap/trunk",
+			wantRoot:   "svn://svn.example.com/zap/trunk",
+			wantBrowse: "https://svn.example.com/zap/trunk",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			assert.Equal(t, tt.wantRoot, repoRoot(tt.repo))
+			assert.Equal(t, tt.wantBrowse, browseURL(tt.repo))
+		})
+	}
+}
+
+func TestIssuesURL(t *testing.T) {
+	tests := []struct {
+		repo string
+		want string
+	}{
+		{repo: "github.com/uber-go/zap", want: "https://github.com/uber-go/zap/issues"},
+		{repo: "ssh://git@github.com/uber-go/zap.git", want: "https://github.com/uber-go/zap/issues"},
+		{repo: "gitlab.com/uber/zap", want: "https://gitlab.com/uber/zap/-/issues"},
+		{repo: "codeberg.org/uber/zap", want: "https://codeberg.org/uber/zap/issues"},
+		{repo: "git.example.com/zap", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			assert.Equal(t, tt.want, issuesURL(tt.repo))
+		})
+	}
+}